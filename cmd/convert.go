@@ -0,0 +1,71 @@
+// Copyright © 2017 Tino Rusch
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"log"
+	"os"
+
+	"github.com/ghodss/yaml"
+	"github.com/spf13/cobra"
+	"github.com/trusch/rkt-compose/lib"
+)
+
+// convertCmd represents the convert command
+var convertCmd = &cobra.Command{
+	Use:   "convert [docker-compose.yml]",
+	Short: "convert a docker-compose file",
+	Long: `convert reads a docker-compose file (version 2 or 3) and prints an
+equivalent rkt-compose file. All services are put into a single pod.
+Everything that can not be mapped is reported as a warning.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		input := "docker-compose.yml"
+		if len(args) > 0 {
+			input = args[0]
+		}
+		composeFile, warnings, err := lib.ConvertDockerCompose(input)
+		if err != nil {
+			return err
+		}
+		if name, _ := cmd.Flags().GetString("name"); name != "" {
+			composeFile.Name = name
+		}
+		for _, warning := range warnings {
+			log.Print("warning: ", warning)
+		}
+		bs, err := yaml.Marshal(composeFile)
+		if err != nil {
+			return err
+		}
+		output, _ := cmd.Flags().GetString("output")
+		if output == "" || output == "-" {
+			_, err = os.Stdout.Write(bs)
+			return err
+		}
+		return lib.WriteFileAtomic(output, bs, 0644)
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(convertCmd)
+	convertCmd.Flags().StringP("output", "o", "", "write the result to this file instead of stdout")
+	convertCmd.Flags().String("name", "", "name of the pod (default is the directory name)")
+}
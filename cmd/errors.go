@@ -0,0 +1,82 @@
+// Copyright © 2017 Tino Rusch
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/trusch/rkt-compose/lib"
+)
+
+// Exit codes of rkt-compose. exec passes the exit code of the command
+// through instead.
+const (
+	// ExitFailure is used for all errors without a more specific code,
+	// e.g. if rkt or systemctl failed
+	ExitFailure = 1
+	// ExitUsage is used for invalid flags and arguments
+	ExitUsage = 2
+	// ExitPodNotRunning is used if the pod needs to run but does not
+	ExitPodNotRunning = 3
+	// ExitInvalidComposeFile is used if a compose file is missing or invalid
+	ExitInvalidComposeFile = 4
+	// ExitImageFetch is used if images could not be fetched
+	ExitImageFetch = 5
+	// ExitLockFile is used if the lock file is missing or stale in frozen mode
+	ExitLockFile = 6
+	// ExitUnhealthy is used if a health check found an unhealthy app
+	ExitUnhealthy = 7
+)
+
+// usageError marks errors caused by invalid flags or arguments
+type usageError struct {
+	error
+}
+
+func newUsageError(format string, args ...interface{}) error {
+	return usageError{fmt.Errorf(format, args...)}
+}
+
+// exitCode returns the exit code documented for err
+func exitCode(err error) int {
+	var usage usageError
+	switch {
+	case errors.As(err, &usage):
+		return ExitUsage
+	case errors.Is(err, lib.ErrPodNotRunning):
+		return ExitPodNotRunning
+	case errors.Is(err, lib.ErrInvalidComposeFile):
+		return ExitInvalidComposeFile
+	case errors.Is(err, lib.ErrImageFetch):
+		return ExitImageFetch
+	case errors.Is(err, lib.ErrLockFile):
+		return ExitLockFile
+	case errors.Is(err, lib.ErrUnhealthy):
+		return ExitUnhealthy
+	}
+	return ExitFailure
+}
+
+func flagError(cmd *cobra.Command, err error) error {
+	return usageError{fmt.Errorf("%v\nRun '%v --help' for usage.", err, cmd.CommandPath())}
+}
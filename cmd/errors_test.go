@@ -0,0 +1,50 @@
+// Copyright © 2017 Tino Rusch
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/trusch/rkt-compose/lib"
+)
+
+func TestExitCode(t *testing.T) {
+	cases := []struct {
+		err      error
+		expected int
+	}{
+		{errors.New("something"), ExitFailure},
+		{newUsageError("unknown format %q", "xml"), ExitUsage},
+		{&lib.Error{Kind: lib.ErrPodNotRunning, Err: errors.New("pod test is not running")}, ExitPodNotRunning},
+		{lib.ValidationErrors{{Message: "unknown field"}}, ExitInvalidComposeFile},
+		{&lib.FetchError{}, ExitImageFetch},
+		{fmt.Errorf("prepare: %w", &lib.Error{Kind: lib.ErrLockFile, Err: errors.New("stale")}), ExitLockFile},
+		{&lib.Error{Kind: lib.ErrUnhealthy, Err: errors.New("unhealthy app(s): web")}, ExitUnhealthy},
+		{&lib.Error{Kind: lib.ErrCommandFailed, Err: errors.New("exit status 1")}, ExitFailure},
+	}
+	for _, c := range cases {
+		if code := exitCode(c.err); code != c.expected {
+			t.Errorf("%v: expected exit code %v, got %v", c.err, c.expected, code)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright © 2017 Tino Rusch
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/trusch/rkt-compose/lib"
+)
+
+// execCmd represents the exec command
+var execCmd = &cobra.Command{
+	Use:   "exec <app> [command...]",
+	Short: "run a command inside an app of your running pod",
+	Long: `run a command inside an app of your running pod
+
+Without a command a shell is started. The exit code of the command is
+passed through.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) == 0 {
+			return newUsageError("exec needs the name of an app")
+		}
+		composeFile, err := getComposeFile()
+		if err != nil {
+			return err
+		}
+		app := args[0]
+		names := []string{}
+		found := false
+		for _, runtimeApp := range composeFile.Manifest.Apps {
+			names = append(names, runtimeApp.Name.String())
+			if runtimeApp.Name.String() == app {
+				found = true
+			}
+		}
+		if !found {
+			return newUsageError("app %q not found in the compose file, available apps: %v", app, strings.Join(names, ", "))
+		}
+		code, err := lib.Exec(getRunner(), composeFile.PodUUIDPath(), app, args[1:])
+		if err != nil {
+			return err
+		}
+		os.Exit(code)
+		return nil
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(execCmd)
+	// everything after the app name belongs to the command
+	execCmd.Flags().SetInterspersed(false)
+}
@@ -0,0 +1,85 @@
+// Copyright © 2017 Tino Rusch
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"encoding/json"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/spf13/cobra"
+	"github.com/trusch/rkt-compose/lib"
+)
+
+// healthCmd represents the health command
+var healthCmd = &cobra.Command{
+	Use:   "health",
+	Short: "run the health checks of your pod",
+	Long: `health runs the healthchecks of all apps once and prints the results.
+Consecutive failures are counted across runs, an app is unhealthy once it
+failed as often as its healthcheck retries. If any app is unhealthy, health
+exits with code 7.
+
+With --watch the checks keep running, each at its interval, until
+rkt-compose gets interrupted. The results show up in status --format.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		composeFile, err := getComposeFile()
+		if err != nil {
+			return err
+		}
+		output, _ := cmd.Flags().GetString("output")
+		if output != "table" && output != "json" {
+			return newUsageError("unknown output %q, use table or json", output)
+		}
+		if watch, _ := cmd.Flags().GetBool("watch"); watch {
+			stop := make(chan struct{})
+			signals := make(chan os.Signal, 1)
+			signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+			go func() {
+				<-signals
+				close(stop)
+			}()
+			return lib.WatchHealth(getRunner(), composeFile, composeFile.PodUUIDPath(), composeFile.PodHealthPath(), stop)
+		}
+		health, err := lib.CheckHealth(getRunner(), composeFile, composeFile.PodUUIDPath(), composeFile.PodHealthPath())
+		if err != nil {
+			return err
+		}
+		if output == "json" {
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			err = encoder.Encode(health)
+		} else {
+			err = health.WriteTable(os.Stdout)
+		}
+		if err != nil {
+			return err
+		}
+		return health.Err()
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(healthCmd)
+	healthCmd.Flags().Bool("watch", false, "keep checking until interrupted")
+	healthCmd.Flags().String("output", "table", "output format: table or json")
+}
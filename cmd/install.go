@@ -0,0 +1,181 @@
+// Copyright © 2017 Tino Rusch
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/trusch/rkt-compose/lib"
+)
+
+// installCmd represents the install command
+var installCmd = &cobra.Command{
+	Use:   "install",
+	Short: "install a systemd unit for your pod",
+	Long: `install writes a persistent systemd service for your pod.
+In contrast to start, the unit survives reboots and can be enabled.
+The pod manifest is brought up to date before every start of the unit.
+Variables taken from the environment are stored in the unit, which is then
+only readable by root.
+An exponential restart backoff (maxBackoff) needs systemd 254 or newer.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		composeFile, err := getComposeFile()
+		if err != nil {
+			return err
+		}
+		if err := lib.CheckDefaultRoutes(composeFile.Networks, lib.NetworkConfigDir); err != nil {
+			return err
+		}
+		verbose, _ := cmd.Flags().GetBool("verbose")
+		unit := lib.NewUnit(composeFile.Name, getManifestPath(composeFile), composeFile.PodUUIDPath(), composeFile.Networks, verbose, composeFile.RunArgs())
+		if unit.PrepareCmd, err = getPrepareCommand(composeFile); err != nil {
+			return err
+		}
+		unit.Environment = getPrepareEnvironment(composeFile)
+		unit.WantedBy, _ = cmd.Flags().GetString("wanted-by")
+		if composeFile.Restart != nil {
+			policy := *composeFile.Restart
+			unit.Restart = &policy
+		}
+		switch restart, _ := cmd.Flags().GetString("restart"); restart {
+		case "":
+		case "no":
+			// retries and backoffs do not apply any more
+			unit.Restart = &lib.RestartPolicy{Policy: restart}
+		default:
+			unit.Restart.Policy = restart
+		}
+		unit.Wants, _ = cmd.Flags().GetStringSlice("wants")
+		unit.After, _ = cmd.Flags().GetStringSlice("after")
+		unitDir, _ := cmd.Flags().GetString("unit-dir")
+		if _, err := unit.Install(getRunner(), unitDir); err != nil {
+			return err
+		}
+		if enable, _ := cmd.Flags().GetBool("enable"); enable {
+			return lib.Enable(getRunner(), composeFile.Name)
+		}
+		return nil
+	},
+}
+
+// enableCmd represents the enable command
+var enableCmd = &cobra.Command{
+	Use:   "enable",
+	Short: "enable the installed unit of your pod",
+	Long:  `enable the installed unit of your pod, so it is started on boot`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		composeFile, err := getComposeFile()
+		if err != nil {
+			return err
+		}
+		return lib.Enable(getRunner(), composeFile.Name)
+	},
+}
+
+// disableCmd represents the disable command
+var disableCmd = &cobra.Command{
+	Use:   "disable",
+	Short: "disable the installed unit of your pod",
+	Long:  `disable the installed unit of your pod, so it is no longer started on boot`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		composeFile, err := getComposeFile()
+		if err != nil {
+			return err
+		}
+		return lib.Disable(getRunner(), composeFile.Name)
+	},
+}
+
+// uninstallCmd represents the uninstall command
+var uninstallCmd = &cobra.Command{
+	Use:   "uninstall",
+	Short: "remove the installed unit of your pod",
+	Long:  `uninstall stops and disables the unit of your pod and removes the unit file`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		composeFile, err := getComposeFile()
+		if err != nil {
+			return err
+		}
+		unitDir, _ := cmd.Flags().GetString("unit-dir")
+		return lib.Uninstall(getRunner(), unitDir, composeFile.Name)
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(installCmd)
+	RootCmd.AddCommand(enableCmd)
+	RootCmd.AddCommand(disableCmd)
+	RootCmd.AddCommand(uninstallCmd)
+	installCmd.Flags().String("wanted-by", "multi-user.target", "target which wants the unit when enabled")
+	installCmd.Flags().String("restart", "", "restart policy of the unit: no, on-failure or always (default is the restart policy of the compose file or on-failure)")
+	installCmd.Flags().StringSlice("wants", []string{"network-online.target"}, "units the pod depends on")
+	installCmd.Flags().StringSlice("after", []string{"network-online.target"}, "units to order the pod after")
+	installCmd.Flags().Bool("enable", false, "enable the unit after installing it")
+	for _, cmd := range []*cobra.Command{installCmd, uninstallCmd} {
+		cmd.Flags().String("unit-dir", lib.DefaultUnitDirectory, "directory of the unit file")
+	}
+}
+
+// getPrepareCommand returns the command line which prepares the pod
+// independent of the working directory
+func getPrepareCommand(composeFile *lib.ComposeFile) ([]string, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	args := []string{exe}
+	for _, path := range getComposeFilePaths() {
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, "--file", abs)
+	}
+	args = append(args,
+		"--project-directory", composeFile.ProjectDirectory,
+		"--manifest", getManifestPath(composeFile),
+	)
+	if viper.GetBool("frozen") {
+		args = append(args, "--frozen")
+	}
+	return append(args, "prepare"), nil
+}
+
+// getPrepareEnvironment returns the variables used by the compose files and
+// by secrets which are set in the environment. The unit needs them to prepare
+// the pod the same way, the .env file is read again by the prepare command.
+func getPrepareEnvironment(composeFile *lib.ComposeFile) map[string]string {
+	env := map[string]string{}
+	for name, value := range composeFile.Variables() {
+		if _, ok := os.LookupEnv(name); ok && value != nil {
+			env[name] = *value
+		}
+	}
+	for _, secret := range composeFile.Secrets {
+		if value, ok := os.LookupEnv(secret.Env); secret.Env != "" && ok {
+			env[secret.Env] = value
+		}
+	}
+	return env
+}
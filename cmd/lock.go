@@ -0,0 +1,56 @@
+// Copyright © 2017 Tino Rusch
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/trusch/rkt-compose/lib"
+)
+
+// lockCmd represents the lock command
+var lockCmd = &cobra.Command{
+	Use:   "lock",
+	Short: "pin the image ids of your pod",
+	Long: `lock resolves the images of all apps and records their ids in the
+lock file next to your compose file. Later prepare runs reuse the pinned ids.
+Use --update to fetch the latest images and refresh the lock file.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		update, _ := cmd.Flags().GetBool("update")
+		composeFile, err := getComposeFile()
+		if err != nil {
+			return err
+		}
+		opts := lib.PrepareOptions{
+			Runner:     getRunner(),
+			FetchJobs:  viper.GetInt("fetch-jobs"),
+			LockFile:   composeFile.LockFilePath(),
+			Frozen:     viper.GetBool("frozen"),
+			UpdateLock: update,
+		}
+		return composeFile.Lock(opts)
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(lockCmd)
+	lockCmd.Flags().Bool("update", false, "fetch the latest images and refresh the lock file")
+}
@@ -21,34 +21,79 @@
 package cmd
 
 import (
+	"os"
+
 	"github.com/spf13/cobra"
 	"github.com/trusch/rkt-compose/lib"
-	"log"
 )
 
 // logsCmd represents the logs command
 var logsCmd = &cobra.Command{
-	Use:   "logs",
+	Use:   "logs [app...] [-- journalctl args...]",
 	Short: "view logs of your pod",
-	Long:  `view logs of your pod`,
-	Run: func(cmd *cobra.Command, args []string) {
-		if err := lib.Logs(args); err != nil {
-			log.Fatal(err)
+	Long: `view logs of your pod
+
+The logs of all apps (or only the given ones) are interleaved and prefixed
+with the app name. Arguments after -- are passed to journalctl.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		composeFile, err := getComposeFile()
+		if err != nil {
+			return err
+		}
+		var extraArgs []string
+		if dash := cmd.ArgsLenAtDash(); dash >= 0 {
+			args, extraArgs = args[:dash], args[dash:]
+		}
+		names := []string{}
+		for _, app := range composeFile.Manifest.Apps {
+			names = append(names, app.Name.String())
+		}
+		for _, app := range args {
+			found := false
+			for _, name := range names {
+				found = found || name == app
+			}
+			if !found {
+				return newUsageError("app %q not found in the compose file", app)
+			}
+		}
+		opts := lib.LogOptions{Apps: args}
+		if len(opts.Apps) == 0 {
+			opts.Apps = names
+		}
+		opts.Follow, _ = cmd.Flags().GetBool("follow")
+		opts.Since, _ = cmd.Flags().GetString("since")
+		opts.Tail, _ = cmd.Flags().GetInt("tail")
+		timestamps, _ := cmd.Flags().GetBool("timestamps")
+		noColor, _ := cmd.Flags().GetBool("no-color")
+		output, _ := cmd.Flags().GetString("output")
+
+		printer := lib.NewLogPrinter(os.Stdout, opts.Apps)
+		printer.Timestamps = timestamps
+		printer.Color = !noColor && lib.IsTerminal(os.Stdout)
+		switch output {
+		case "text":
+		case "json":
+			printer.JSON = true
+		default:
+			return newUsageError("unknown output %q, use text or json", output)
+		}
+
+		reader, err := lib.NewJournalReader(getRunner(), composeFile.PodUUIDPath())
+		if err != nil {
+			return err
 		}
+		reader.ExtraArgs = extraArgs
+		return lib.Logs(reader, opts, printer)
 	},
 }
 
 func init() {
 	RootCmd.AddCommand(logsCmd)
-
-	// Here you will define your flags and configuration settings.
-
-	// Cobra supports Persistent Flags which will work for this command
-	// and all subcommands, e.g.:
-	// logsCmd.PersistentFlags().String("foo", "", "A help for foo")
-
-	// Cobra supports local flags which will only run when this command
-	// is called directly, e.g.:
-	// logsCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
-
+	logsCmd.Flags().Bool("follow", false, "follow the log output")
+	logsCmd.Flags().String("since", "", "show logs since a time (e.g. \"2017-06-01 12:00\") or a duration (e.g. 10m)")
+	logsCmd.Flags().Int("tail", 0, "number of lines to show from the end of the logs, 0 for all")
+	logsCmd.Flags().Bool("timestamps", false, "show timestamps")
+	logsCmd.Flags().Bool("no-color", false, "do not color the app names")
+	logsCmd.Flags().String("output", "text", "output format: text or json")
 }
@@ -0,0 +1,85 @@
+// Copyright © 2017 Tino Rusch
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"log"
+
+	"github.com/spf13/cobra"
+	"github.com/trusch/rkt-compose/lib"
+)
+
+// networkCmd represents the network command
+var networkCmd = &cobra.Command{
+	Use:   "network",
+	Short: "manage the networks of your pod",
+}
+
+// networkCreateCmd represents the network create command
+var networkCreateCmd = &cobra.Command{
+	Use:   "create [network...]",
+	Short: "create missing networks",
+	Long: `create writes a CNI bridge config for every network of the compose file
+which is neither built into rkt nor configured yet. Networks can also be
+named explicitly. The subnet is taken from --subnet, from the /24 of a static
+ip of the network or is the first free /24 of 10.100.0.0/16.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		composeFile, err := getComposeFile()
+		if err != nil {
+			return err
+		}
+		dir, _ := cmd.Flags().GetString("dir")
+		subnet, _ := cmd.Flags().GetString("subnet")
+		networks := composeFile.Networks
+		if len(args) > 0 {
+			networks = []*lib.Network{}
+			for _, name := range args {
+				network := &lib.Network{Name: name}
+				for _, existing := range composeFile.Networks {
+					if existing.Name == name {
+						network = existing
+					}
+				}
+				networks = append(networks, network)
+			}
+		}
+		missing, err := lib.MissingNetworks(networks, dir)
+		if err != nil {
+			return err
+		}
+		if len(missing) == 0 {
+			log.Print("all networks exist")
+			return nil
+		}
+		if subnet != "" && len(missing) > 1 {
+			return newUsageError("--subnet can only be used for a single network, %v are missing", len(missing))
+		}
+		_, err = lib.CreateNetworks(getRunner(), missing, subnet, dir)
+		return err
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(networkCmd)
+	networkCmd.AddCommand(networkCreateCmd)
+	networkCreateCmd.Flags().String("dir", lib.NetworkConfigDir, "directory of the CNI network configs")
+	networkCreateCmd.Flags().String("subnet", "", "subnet of the network, e.g. 10.1.2.0/24")
+}
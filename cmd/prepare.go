@@ -21,8 +21,10 @@
 package cmd
 
 import (
+	"bytes"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
+	"github.com/trusch/rkt-compose/lib"
 	"log"
 	"os"
 )
@@ -31,40 +33,68 @@ import (
 var prepareCmd = &cobra.Command{
 	Use:   "prepare",
 	Short: "prepare prepares a pod for run",
-	Long:  `prepare prepares a pod for run`,
-	Run: func(cmd *cobra.Command, args []string) {
-		prepare()
+	Long: `prepare prepares a pod for run.
+The pod manifest is only regenerated if any of its inputs changed: the compose
+files, the variables used, the lock file or the image ids.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		force, _ := cmd.Flags().GetBool("force")
+		_, err := prepare(force)
+		return err
 	},
 }
 
 func init() {
 	RootCmd.AddCommand(prepareCmd)
+	prepareCmd.Flags().Bool("force", false, "always regenerate the pod manifest")
 }
 
-func prepare() {
-	if checkIfPrepareNeeded() {
-		log.Print("prepare pod-manifest...")
-		composeFile := getComposeFile()
-		targetFile, err := os.Create(viper.GetString("manifest"))
+// prepare parses the compose files and prepares the pod. The compose file
+// is returned, so that it does not need to be parsed again.
+func prepare(force bool) (*lib.ComposeFile, error) {
+	composeFile, err := getComposeFile()
+	if err != nil {
+		return nil, err
+	}
+	if err := prepareComposeFile(composeFile, force); err != nil {
+		return nil, err
+	}
+	return composeFile, nil
+}
+
+// prepareComposeFile writes the pod manifest of composeFile if needed
+func prepareComposeFile(composeFile *lib.ComposeFile, force bool) error {
+	opts := lib.PrepareOptions{
+		Runner:    getRunner(),
+		FetchJobs: viper.GetInt("fetch-jobs"),
+		LockFile:  composeFile.LockFilePath(),
+		Frozen:    viper.GetBool("frozen"),
+	}
+	// warn even if the manifest is up to date
+	for _, warning := range composeFile.Warnings() {
+		log.Printf("warning: %v", warning)
+	}
+	if !force {
+		needed, reason, err := composeFile.PrepareNeeded(getManifestPath(composeFile), opts)
 		if err != nil {
-			log.Fatal(err)
+			return err
 		}
-		defer targetFile.Close()
-		if err := composeFile.Prepare(targetFile); err != nil {
-			log.Fatal("error preparing pod-manifest: ", err)
+		if !needed {
+			log.Print("manifest already up to date")
+			return nil
 		}
-	} else {
-		log.Print("manifest already up to date")
+		log.Printf("manifest needs to be regenerated: %v", reason)
 	}
-}
-
-func checkIfPrepareNeeded() bool {
-	composePath := viper.GetString("file")
-	manifestPath := viper.GetString("manifest")
-	composeStat, err1 := os.Stat(composePath)
-	manifestStat, err2 := os.Stat(manifestPath)
-	if err1 != nil || err2 != nil || composeStat.ModTime().After(manifestStat.ModTime()) {
-		return true
+	log.Print("prepare pod-manifest...")
+	manifest := &bytes.Buffer{}
+	if err := composeFile.Prepare(manifest, opts); err != nil {
+		return err
+	}
+	if viper.GetBool("dry-run") {
+		log.Printf("dry-run: would write manifest %v:", getManifestPath(composeFile))
+		_, err := os.Stdout.Write(manifest.Bytes())
+		return err
 	}
-	return false
+	// only write the manifest on success, so a failed prepare is retried.
+	// It may contain secrets injected into the environment of apps.
+	return lib.WriteFileAtomic(getManifestPath(composeFile), manifest.Bytes(), 0600)
 }
@@ -23,7 +23,6 @@ package cmd
 import (
 	"github.com/spf13/cobra"
 	"github.com/trusch/rkt-compose/lib"
-	"log"
 )
 
 // restartCmd represents the restart command
@@ -31,12 +30,12 @@ var restartCmd = &cobra.Command{
 	Use:   "restart",
 	Short: "restart your pod",
 	Long:  `restart your pod`,
-	Run: func(cmd *cobra.Command, args []string) {
-		composeFile := getComposeFile()
-		err := lib.Restart(composeFile.Name)
+	RunE: func(cmd *cobra.Command, args []string) error {
+		composeFile, err := getComposeFile()
 		if err != nil {
-			log.Fatal(err)
+			return err
 		}
+		return lib.Restart(getRunner(), composeFile.Name)
 	},
 }
 
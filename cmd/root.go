@@ -24,6 +24,7 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"path/filepath"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -36,7 +37,18 @@ var cfgFile string
 var RootCmd = &cobra.Command{
 	Use:   "rkt-compose",
 	Short: "rkt-compose prepares and runs rkt pods for you",
-	Long:  `rkt-compose prepares and runs rkt pods for you`,
+	Long: `rkt-compose prepares and runs rkt pods for you
+
+Exit codes:
+  1  failure, e.g. rkt or systemctl failed
+  2  invalid flags or arguments
+  3  the pod is not running
+  4  a compose file is missing or invalid
+  5  images could not be fetched
+  6  the lock file is missing or stale (--frozen), or a locked image changed
+  7  an app is unhealthy (health)`,
+	SilenceErrors: true,
+	SilenceUsage:  true,
 	// Uncomment the following line if your bare application
 	// has an action associated with it:
 	//	Run: func(cmd *cobra.Command, args []string) { },
@@ -46,13 +58,14 @@ var RootCmd = &cobra.Command{
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() {
 	if err := RootCmd.Execute(); err != nil {
-		fmt.Println(err)
-		os.Exit(-1)
+		log.Print(err)
+		os.Exit(exitCode(err))
 	}
 }
 
 func init() {
 	cobra.OnInitialize(initConfig)
+	RootCmd.SetFlagErrorFunc(flagError)
 	log.SetPrefix("rkt-compose: ")
 	log.SetFlags(0)
 	// Here you will define your flags and configuration settings.
@@ -60,9 +73,13 @@ func init() {
 	// will be global for your application.
 
 	RootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.rkt-compose.yaml)")
-	RootCmd.PersistentFlags().StringP("file", "f", "rkt-compose.yaml", "compose file")
-	RootCmd.PersistentFlags().StringP("manifest", "m", ".pod-manifest.json", "manifest file")
+	RootCmd.PersistentFlags().StringArrayP("file", "f", []string{"rkt-compose.yaml"}, "compose file (can be repeated, later files override earlier ones)")
+	RootCmd.PersistentFlags().StringP("manifest", "m", ".pod-manifest.json", "manifest file (relative to the project directory)")
+	RootCmd.PersistentFlags().String("project-directory", "", "base directory for relative paths (default is the directory of the first compose file)")
+	RootCmd.PersistentFlags().Int("fetch-jobs", 4, "number of images to fetch concurrently")
+	RootCmd.PersistentFlags().Bool("frozen", false, "fail if the lock file is missing or stale instead of updating it")
 	RootCmd.PersistentFlags().BoolP("verbose", "v", false, "verbose mode")
+	RootCmd.PersistentFlags().Bool("dry-run", false, "print what would be done without changing anything")
 	viper.BindPFlags(RootCmd.PersistentFlags())
 }
 
@@ -82,11 +99,35 @@ func initConfig() {
 	}
 }
 
-func getComposeFile() *lib.ComposeFile {
-	file := viper.GetString("file")
-	composeFile, err := lib.NewComposeFile(file)
+// getRunner returns the runner the library runs rkt and systemctl with.
+// In dry-run mode commands which change anything are only logged.
+func getRunner() lib.Runner {
+	if viper.GetBool("dry-run") {
+		return &lib.DryRunner{Runner: lib.ExecRunner{}}
+	}
+	return lib.ExecRunner{}
+}
+
+func getComposeFile() (*lib.ComposeFile, error) {
+	composeFile, err := lib.NewComposeFile(getComposeFilePaths()...)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
+	}
+	if dir := viper.GetString("project-directory"); dir != "" {
+		if composeFile.ProjectDirectory, err = filepath.Abs(dir); err != nil {
+			return nil, err
+		}
 	}
-	return composeFile
+	return composeFile, nil
+}
+
+func getManifestPath(composeFile *lib.ComposeFile) string {
+	return composeFile.ProjectPath(viper.GetString("manifest"))
+}
+
+// getComposeFilePaths reads the flag directly, viper would split the paths
+// on commas.
+func getComposeFilePaths() []string {
+	paths, _ := RootCmd.PersistentFlags().GetStringArray("file")
+	return paths
 }
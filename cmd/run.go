@@ -22,10 +22,7 @@ package cmd
 
 import (
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
 	"github.com/trusch/rkt-compose/lib"
-	"log"
-	"strings"
 )
 
 // runCmd represents the run command
@@ -33,14 +30,14 @@ var runCmd = &cobra.Command{
 	Use:   "run",
 	Short: "run a pod",
 	Long:  `run a pod`,
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		interactive, _ := cmd.Flags().GetBool("interactive")
 		verbose, _ := cmd.Flags().GetBool("verbose")
-		prepare()
-		composeFile := getComposeFile()
-		if err := lib.Run(viper.GetString("manifest"), strings.Join(composeFile.Networks, ","), interactive, verbose, composeFile.Extra); err != nil {
-			log.Fatal(err)
+		composeFile, err := prepare(false)
+		if err != nil {
+			return err
 		}
+		return lib.Run(getRunner(), getManifestPath(composeFile), composeFile.PodUUIDPath(), composeFile.Networks, interactive, verbose, composeFile.RunArgs())
 	},
 }
 
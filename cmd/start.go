@@ -21,26 +21,28 @@
 package cmd
 
 import (
+	"errors"
+
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
 	"github.com/trusch/rkt-compose/lib"
-	"log"
-	"strings"
 )
 
 // startCmd represents the start command
 var startCmd = &cobra.Command{
 	Use:   "start",
 	Short: "start your pod",
-	Long:  `start your pod.`,
-	Run: func(cmd *cobra.Command, args []string) {
-		prepare()
-		composeFile := getComposeFile()
+	Long: `start your pod.
+An exponential restart backoff (maxBackoff) needs systemd 254 or newer.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		composeFile, err := prepare(false)
+		if err != nil {
+			return err
+		}
 		verbose, _ := cmd.Flags().GetBool("verbose")
-		lib.Stop(composeFile.Name)
-		if err := lib.Start(composeFile.Name, viper.GetString("manifest"), strings.Join(composeFile.Networks, ","), verbose, composeFile.Extra); err != nil {
-			log.Fatal(err)
+		if err := lib.Stop(getRunner(), composeFile.Name); err != nil && !errors.Is(err, lib.ErrPodNotRunning) {
+			return err
 		}
+		return lib.Start(getRunner(), composeFile.Name, getManifestPath(composeFile), composeFile.PodUUIDPath(), composeFile.Networks, composeFile.Restart, nil, verbose, composeFile.RunArgs())
 	},
 }
 
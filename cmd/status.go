@@ -21,36 +21,56 @@
 package cmd
 
 import (
+	"encoding/json"
+	"os"
+
+	"github.com/ghodss/yaml"
 	"github.com/spf13/cobra"
 	"github.com/trusch/rkt-compose/lib"
-	"log"
 )
 
 // statusCmd represents the status command
 var statusCmd = &cobra.Command{
 	Use:   "status",
 	Short: "get status of your pod",
-	Long:  `get status of your pod`,
-	Run: func(cmd *cobra.Command, args []string) {
-		composeFile := getComposeFile()
-		err := lib.Status(composeFile.Name)
+	Long: `get status of your pod
+
+Without --format the output of systemctl status is shown. The formats
+table, json and yaml combine the state of the systemd unit with the state
+rkt reports for the pod and its apps.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		composeFile, err := getComposeFile()
+		if err != nil {
+			return err
+		}
+		format, _ := cmd.Flags().GetString("format")
+		if format == "" {
+			return lib.Status(getRunner(), composeFile.Name)
+		}
+		status, err := lib.GetPodStatus(getRunner(), composeFile.Name, composeFile.PodUUIDPath(), getManifestPath(composeFile), composeFile.PodHealthPath())
 		if err != nil {
-			log.Fatal(err)
+			return err
 		}
+		switch format {
+		case "table":
+			err = status.WriteTable(os.Stdout)
+		case "json":
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			err = encoder.Encode(status)
+		case "yaml":
+			var bs []byte
+			if bs, err = yaml.Marshal(status); err == nil {
+				_, err = os.Stdout.Write(bs)
+			}
+		default:
+			err = newUsageError("unknown format %q, use table, json or yaml", format)
+		}
+		return err
 	},
 }
 
 func init() {
 	RootCmd.AddCommand(statusCmd)
-
-	// Here you will define your flags and configuration settings.
-
-	// Cobra supports Persistent Flags which will work for this command
-	// and all subcommands, e.g.:
-	// statusCmd.PersistentFlags().String("foo", "", "A help for foo")
-
-	// Cobra supports local flags which will only run when this command
-	// is called directly, e.g.:
-	// statusCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
-
+	statusCmd.Flags().String("format", "", "output format: table, json or yaml")
 }
@@ -21,8 +21,6 @@
 package cmd
 
 import (
-	"log"
-
 	"github.com/spf13/cobra"
 	"github.com/trusch/rkt-compose/lib"
 )
@@ -32,12 +30,12 @@ var stopCmd = &cobra.Command{
 	Use:   "stop",
 	Short: "stop your pod",
 	Long:  `stop your pod.`,
-	Run: func(cmd *cobra.Command, args []string) {
-		composeFile := getComposeFile()
-		err := lib.Stop(composeFile.Name)
+	RunE: func(cmd *cobra.Command, args []string) error {
+		composeFile, err := getComposeFile()
 		if err != nil {
-			log.Fatal(err)
+			return err
 		}
+		return lib.Stop(getRunner(), composeFile.Name)
 	},
 }
 
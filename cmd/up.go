@@ -0,0 +1,108 @@
+// Copyright © 2017 Tino Rusch
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"errors"
+	"log"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/trusch/rkt-compose/lib"
+)
+
+// upCmd represents the up command
+var upCmd = &cobra.Command{
+	Use:   "up",
+	Short: "start all pods of a project",
+	Long: `up starts all pods of a project in dependency order.
+Every pod runs as its own systemd unit, which requires and is ordered after
+the units of the pods it depends on. Stopping a pod therefore also stops the
+pods depending on it.
+An exponential restart backoff (maxBackoff) needs systemd 254 or newer.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		project, err := getProject(cmd)
+		if err != nil {
+			return err
+		}
+		pods, err := project.StartOrder()
+		if err != nil {
+			return err
+		}
+		if manifest := viper.GetString("manifest"); filepath.IsAbs(manifest) && len(pods) > 1 {
+			// the pods would overwrite the manifests of each other
+			return newUsageError("--manifest %v is shared by all pods, give a path relative to the project directories", manifest)
+		}
+		verbose, _ := cmd.Flags().GetBool("verbose")
+		for _, pod := range pods {
+			log.Printf("starting pod %v...", pod.Name)
+			composeFile := pod.ComposeFile
+			if err := prepareComposeFile(composeFile, false); err != nil {
+				return err
+			}
+			if err := lib.Stop(getRunner(), pod.Name); err != nil && !errors.Is(err, lib.ErrPodNotRunning) {
+				return err
+			}
+			if err := lib.Start(getRunner(), pod.Name, getManifestPath(composeFile), composeFile.PodUUIDPath(), composeFile.Networks, composeFile.Restart, pod.DependsOn, verbose, composeFile.RunArgs()); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+}
+
+// downCmd represents the down command
+var downCmd = &cobra.Command{
+	Use:   "down",
+	Short: "stop all pods of a project",
+	Long:  `down stops all pods of a project in reverse dependency order.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		project, err := getProject(cmd)
+		if err != nil {
+			return err
+		}
+		pods, err := project.StopOrder()
+		if err != nil {
+			return err
+		}
+		for _, pod := range pods {
+			log.Printf("stopping pod %v...", pod.Name)
+			if err := lib.Stop(getRunner(), pod.Name); err != nil && !errors.Is(err, lib.ErrPodNotRunning) {
+				return err
+			}
+		}
+		return nil
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(upCmd)
+	RootCmd.AddCommand(downCmd)
+	for _, cmd := range []*cobra.Command{upCmd, downCmd} {
+		cmd.Flags().StringP("project", "p", lib.ProjectFileName, "project file listing the pods")
+	}
+}
+
+func getProject(cmd *cobra.Command) (*lib.Project, error) {
+	path, _ := cmd.Flags().GetString("project")
+	return lib.NewProject(path)
+}
@@ -0,0 +1,58 @@
+// Copyright © 2017 Tino Rusch
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/spf13/cobra"
+	"github.com/trusch/rkt-compose/lib"
+)
+
+// validateCmd represents the validate command
+var validateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "validate your compose file",
+	Long: `validate checks your compose file for unknown keys, invalid names, missing volumes and malformed resource quantities and reports all problems found.
+Environment variables which look like credentials but are given as literal values are reported as warnings.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		composeFile, err := lib.NewComposeFile(getComposeFilePaths()...)
+		if errs, ok := err.(lib.ValidationErrors); ok {
+			for _, e := range errs {
+				fmt.Println(e)
+			}
+			return &lib.Error{Kind: lib.ErrInvalidComposeFile, Err: fmt.Errorf("found %v problem(s)", len(errs))}
+		}
+		if err != nil {
+			return err
+		}
+		for _, warning := range composeFile.Warnings() {
+			fmt.Println("warning: " + warning.Error())
+		}
+		log.Print("compose file is valid")
+		return nil
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(validateCmd)
+}
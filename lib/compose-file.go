@@ -1,38 +1,59 @@
 package lib
 
 import (
-	"bytes"
 	"encoding/json"
 	"fmt"
 	"github.com/appc/spec/schema"
 	"github.com/appc/spec/schema/types"
 	"github.com/ghodss/yaml"
+	yamlv3 "gopkg.in/yaml.v3"
 	"io"
 	"io/ioutil"
 	"log"
 	"os"
-	"os/exec"
 	"path/filepath"
-	"strings"
+	"reflect"
 )
 
 // ComposeFile represents a single compose file
 type ComposeFile struct {
-	Name     string      `json:"name" yaml:"name,omitempty"`
-	CPU      string      `json:"cpu" yaml:"cpu,omitempty"`
-	Memory   string      `json:"memory" yaml:"memory,omitempty"`
-	Networks []string    `json:"networks" yaml:"networks,omitempty"`
-	Extra    []string    `json:"extra" yaml:"extra,omitempty"`
-	Manifest PodManifest `json:"manifest" yaml:"manifest,omitempty"`
+	Name     string     `json:"name,omitempty" yaml:"name,omitempty"`
+	CPU      string     `json:"cpu,omitempty" yaml:"cpu,omitempty"`
+	Memory   string     `json:"memory,omitempty" yaml:"memory,omitempty"`
+	Networks []*Network `json:"networks,omitempty" yaml:"networks,omitempty"`
+	// Hostname is the hostname of the pod
+	Hostname string `json:"hostname,omitempty" yaml:"hostname,omitempty"`
+	// DNS lists name servers, or is host or none to take the resolv.conf of
+	// the host or of the image
+	DNS        []string `json:"dns,omitempty" yaml:"dns,omitempty"`
+	DNSSearch  []string `json:"dnsSearch,omitempty" yaml:"dnsSearch,omitempty"`
+	DNSOptions []string `json:"dnsOptions,omitempty" yaml:"dnsOptions,omitempty"`
+	DNSDomain  string   `json:"dnsDomain,omitempty" yaml:"dnsDomain,omitempty"`
+	// HostsEntries are added to /etc/hosts as IP=HOSTNAME, host copies the
+	// /etc/hosts of the host
+	HostsEntries []string `json:"hostsEntries,omitempty" yaml:"hostsEntries,omitempty"`
+	// Stage1 selects the stage1 image: a flavor like kvm or fly, an image
+	// name, a path, an url or an image hash
+	Stage1   string         `json:"stage1,omitempty" yaml:"stage1,omitempty"`
+	Extra    []string       `json:"extra,omitempty" yaml:"extra,omitempty"`
+	Restart  *RestartPolicy `json:"restart,omitempty" yaml:"restart,omitempty"`
+	Secrets  []*Secret      `json:"secrets,omitempty" yaml:"secrets,omitempty"`
+	Manifest PodManifest    `json:"manifest" yaml:"manifest,omitempty"`
+
+	// ProjectDirectory is the base for all relative paths.
+	// It defaults to the directory of the first compose file.
+	ProjectDirectory string `json:"-" yaml:"-"`
+
+	sources []*composeSource
 }
 
 // A PodManifest mimics the appc PodManifest but without validation
 type PodManifest struct {
-	Apps            []*RuntimeApp         `json:"apps" yaml:"apps,omitempty"`
-	Volumes         []*Volume             `json:"volumes" yaml:"volumes,omitempty"`
-	Isolators       []types.Isolator      `json:"isolators" yaml:"isolators,omitempty"`
-	Annotations     types.Annotations     `json:"annotations" yaml:"annotations,omitempty"`
-	Ports           []types.ExposedPort   `json:"ports" yaml:"ports,omitempty"`
+	Apps            []*RuntimeApp         `json:"apps,omitempty" yaml:"apps,omitempty"`
+	Volumes         []*Volume             `json:"volumes,omitempty" yaml:"volumes,omitempty"`
+	Isolators       []types.Isolator      `json:"isolators,omitempty" yaml:"isolators,omitempty"`
+	Annotations     types.Annotations     `json:"annotations,omitempty" yaml:"annotations,omitempty"`
+	Ports           []types.ExposedPort   `json:"ports,omitempty" yaml:"ports,omitempty"`
 	UserAnnotations types.UserAnnotations `json:"userAnnotations,omitempty" yaml:"userAnnotations,omitempty"`
 	UserLabels      types.UserLabels      `json:"userLabels,omitempty" yaml:"userLabels,omitempty"`
 }
@@ -42,17 +63,28 @@ type RuntimeApp struct {
 	Name           types.ACName      `json:"name" yaml:"name,omitempty"`
 	Image          RuntimeImage      `json:"image" yaml:"image,omitempty"`
 	App            *App              `json:"app,omitempty" yaml:"app,omitempty"`
-	ReadOnlyRootFS bool              `json:"readOnlyRootFS,omitempty" yaml:"readOnlyRootFS,omitempty"`
+	ReadOnlyRootFS *bool             `json:"readOnlyRootFS,omitempty" yaml:"readOnlyRootFS,omitempty"`
 	Mounts         []schema.Mount    `json:"mounts,omitempty" yaml:"mounts,omitempty"`
 	Annotations    types.Annotations `json:"annotations,omitempty" yaml:"annotations,omitempty"`
+	// DependsOn lists apps which have to be ready before this app starts
+	DependsOn []string `json:"dependsOn,omitempty" yaml:"dependsOn,omitempty"`
+	// Readiness tells when the app is ready for the apps depending on it
+	Readiness *Readiness `json:"readiness,omitempty" yaml:"readiness,omitempty"`
+	// Healthcheck tells whether the running app is healthy
+	Healthcheck *Healthcheck `json:"healthcheck,omitempty" yaml:"healthcheck,omitempty"`
+	// Secrets lists the secrets handed to the app
+	Secrets []*AppSecret `json:"secrets,omitempty" yaml:"secrets,omitempty"`
+	// Publish lists ports of the app forwarded from the host, written as
+	// [hostIP:]hostPort:port[/protocol]
+	Publish []string `json:"publish,omitempty" yaml:"publish,omitempty"`
 }
 
 // A App mimics the appc App but without validation
 type App struct {
 	Exec              types.Exec            `json:"exec" yaml:"exec,omitempty"`
 	EventHandlers     []types.EventHandler  `json:"eventHandlers,omitempty" yaml:"eventHandlers,omitempty"`
-	User              string                `json:"user" yaml:"user,omitempty"`
-	Group             string                `json:"group" yaml:"group,omitempty"`
+	User              string                `json:"user,omitempty" yaml:"user,omitempty"`
+	Group             string                `json:"group,omitempty" yaml:"group,omitempty"`
 	SupplementaryGIDs []int                 `json:"supplementaryGIDs,omitempty" yaml:"supplementaryGIDs,omitempty"`
 	WorkingDirectory  string                `json:"workingDirectory,omitempty" yaml:"workingDirectory,omitempty"`
 	Environment       types.Environment     `json:"environment,omitempty" yaml:"environment,omitempty"`
@@ -61,6 +93,10 @@ type App struct {
 	Isolators         types.Isolators       `json:"isolators,omitempty" yaml:"isolators,omitempty"`
 	UserAnnotations   types.UserAnnotations `json:"userAnnotations,omitempty" yaml:"userAnnotations,omitempty"`
 	UserLabels        types.UserLabels      `json:"userLabels,omitempty" yaml:"userLabels,omitempty"`
+	CPU               string                `json:"cpu,omitempty" yaml:"cpu,omitempty"`
+	CPURequest        string                `json:"cpuRequest,omitempty" yaml:"cpuRequest,omitempty"`
+	Memory            string                `json:"memory,omitempty" yaml:"memory,omitempty"`
+	MemoryRequest     string                `json:"memoryRequest,omitempty" yaml:"memoryRequest,omitempty"`
 }
 
 // A RuntimeImage mimics the appc RuntimeImage but without validation
@@ -73,7 +109,7 @@ type RuntimeImage struct {
 // A Volume mimics the appc Volume but without validation
 type Volume struct {
 	Name      types.ACName `json:"name" yaml:"name,omitempty"`
-	Kind      string       `json:"kind" yaml:"kind,omitempty"`
+	Kind      string       `json:"kind,omitempty" yaml:"kind,omitempty"`
 	Source    string       `json:"source,omitempty" yaml:"source,omitempty"`
 	ReadOnly  *bool        `json:"readOnly,omitempty" yaml:"readOnly,omitempty"`
 	Recursive *bool        `json:"recursive,omitempty" yaml:"recursive,omitempty"`
@@ -82,52 +118,128 @@ type Volume struct {
 	GID       *int         `json:"gid,omitempty" yaml:"gid,omitempty"`
 }
 
-// NewComposeFile parses a composefile from disk
-func NewComposeFile(path string) (*ComposeFile, error) {
+// NewComposeFile parses one or more composefiles from disk.
+// If multiple files are given, they are merged in order so that later files
+// override earlier ones. The result is validated, invalid files yield
+// ValidationErrors listing all problems found.
+func NewComposeFile(paths ...string) (*ComposeFile, error) {
+	if len(paths) == 0 {
+		return nil, newError(ErrInvalidComposeFile, "no compose file specified")
+	}
+	composeFile := &ComposeFile{}
+	problems := ValidationErrors{}
+	decoded := true
+	for _, path := range paths {
+		part, err := parseComposeFile(path)
+		if errs, ok := err.(ValidationErrors); ok {
+			problems = append(problems, errs...)
+		} else if err != nil {
+			return nil, wrapError(ErrInvalidComposeFile, err)
+		}
+		if part == nil {
+			decoded = false
+			continue
+		}
+		composeFile.Merge(part)
+	}
+	// a file which could not be decoded would only cause follow-up errors
+	if decoded {
+		if errs, ok := composeFile.Validate().(ValidationErrors); ok {
+			problems = append(problems, errs...)
+		}
+	}
+	if len(problems) > 0 {
+		return nil, problems
+	}
+	if len(composeFile.Networks) == 0 {
+		composeFile.Networks = []*Network{{Name: "default"}}
+	}
+	dir, err := filepath.Abs(filepath.Dir(paths[0]))
+	if err != nil {
+		return nil, err
+	}
+	composeFile.ProjectDirectory = dir
+	return composeFile, nil
+}
+
+// ProjectPath resolves path relative to the project directory
+func (composeFile *ComposeFile) ProjectPath(path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(composeFile.ProjectDirectory, path)
+}
+
+// PodUUIDPath returns the path of the file rkt saves the pod uuid to
+func (composeFile *ComposeFile) PodUUIDPath() string {
+	return composeFile.ProjectPath(PodUUIDFile)
+}
+
+// PodHealthPath returns the path of the file the results of health checks
+// are saved to
+func (composeFile *ComposeFile) PodHealthPath() string {
+	return composeFile.ProjectPath(PodHealthFile)
+}
+
+// parseComposeFile reads a single compose file. Schema problems are
+// returned as ValidationErrors, along with the compose file if it could
+// still be decoded.
+func parseComposeFile(path string) (*ComposeFile, error) {
 	bs, err := ioutil.ReadFile(path)
 	if err != nil {
 		return nil, err
 	}
+	doc := &yamlv3.Node{}
+	if err := yamlv3.Unmarshal(bs, doc); err != nil {
+		return nil, ValidationErrors{{File: path, Message: err.Error()}}
+	}
+	dotEnv, err := loadDotEnv(filepath.Join(filepath.Dir(path), ".env"))
+	if err != nil {
+		return nil, err
+	}
+	// literal values are only known before variables get substituted
+	warnings := lintSecrets(doc)
+	variables := map[string]*string{}
+	problems := interpolateNode(doc, "", newVariableLookup(dotEnv, variables))
+	problems = append(problems, checkSchema(doc, reflect.TypeOf(ComposeFile{}), "")...)
+	for _, problem := range problems {
+		problem.File = path
+	}
+	if doc.Kind != 0 {
+		if bs, err = yamlv3.Marshal(doc); err != nil {
+			return nil, err
+		}
+	}
 	composeFile := &ComposeFile{}
 	if err := yaml.Unmarshal(bs, composeFile); err != nil {
-		return nil, err
+		if len(problems) > 0 {
+			// the schema problems already tell why decoding failed
+			return nil, problems
+		}
+		return nil, ValidationErrors{{File: path, Message: err.Error()}}
 	}
-	if len(composeFile.Networks) == 0 {
-		composeFile.Networks = []string{"default"}
+	for _, warning := range warnings {
+		warning.File = path
+	}
+	composeFile.sources = []*composeSource{{path: path, doc: doc, variables: variables, warnings: warnings}}
+	if len(problems) > 0 {
+		return composeFile, problems
 	}
 	return composeFile, nil
 }
 
-func (composeFile *ComposeFile) fetchImages() error {
-	log.Print("fetch images...")
-	for _, app := range composeFile.Manifest.Apps {
-		if app.Image.ID.Empty() {
-			url := app.Image.Name
-			for _, label := range app.Image.Labels {
-				url += fmt.Sprintf(",%v=%v", label.Name, label.Value)
-			}
-			args := []string{"fetch"}
-			if strings.HasPrefix(url, "docker://") {
-				args = append(args, "--insecure-options=image")
-			}
-			args = append(args, url)
-			log.Printf("fetching image %v...", url)
-			cmd := exec.Command("rkt", args...)
-			buf := &bytes.Buffer{}
-			cmd.Stdout = buf
-			cmd.Stderr = os.Stderr
-			if err := cmd.Run(); err != nil {
-				return err
-			}
-			hash, err := types.NewHash(strings.Trim(buf.String(), "\n"))
-			if err != nil {
-				return err
-			}
-			app.Image.ID = *hash
-			log.Printf("fetched image %v with id %v.", url, app.Image.ID.String())
-		}
+// MarshalJSON omits the image id if it is not yet known
+func (image RuntimeImage) MarshalJSON() ([]byte, error) {
+	type runtimeImage struct {
+		Name   string       `json:"name,omitempty"`
+		ID     *types.Hash  `json:"id,omitempty"`
+		Labels types.Labels `json:"labels,omitempty"`
 	}
-	return nil
+	out := runtimeImage{Name: image.Name, Labels: image.Labels}
+	if !image.ID.Empty() {
+		out.ID = &image.ID
+	}
+	return json.Marshal(out)
 }
 
 // GetAppcPodManifest returns a appc conform manifest for this pod
@@ -183,7 +295,7 @@ func (composeFile *ComposeFile) GetAppcPodManifest() (*schema.PodManifest, error
 				UserAnnotations:   app.App.UserAnnotations,
 				UserLabels:        app.App.UserLabels,
 			},
-			ReadOnlyRootFS: app.ReadOnlyRootFS,
+			ReadOnlyRootFS: boolValue(app.ReadOnlyRootFS),
 			Mounts:         app.Mounts,
 			Annotations:    app.Annotations,
 		}
@@ -193,39 +305,38 @@ func (composeFile *ComposeFile) GetAppcPodManifest() (*schema.PodManifest, error
 		if app.App.Group == "" {
 			result.Apps[idx].App.Group = "0"
 		}
-	}
-	if composeFile.CPU != "" {
-		cpuIso, err := types.NewResourceCPUIsolator(composeFile.CPU, composeFile.CPU)
+		isolators, err := resourceIsolators(app.App.CPU, app.App.CPURequest, app.App.Memory, app.App.MemoryRequest)
 		if err != nil {
-			return nil, err
+			return nil, fmt.Errorf("app %v: %v", app.Name, err)
 		}
-		result.Isolators = append(result.Isolators, cpuIso.AsIsolator())
+		result.Apps[idx].App.Isolators = mergeIsolators(append(types.Isolators{}, app.App.Isolators...), isolators)
 	}
-
-	if composeFile.Memory != "" {
-		memIso, err := types.NewResourceMemoryIsolator(composeFile.Memory, composeFile.Memory)
-		if err != nil {
-			return nil, err
-		}
-		result.Isolators = append(result.Isolators, memIso.AsIsolator())
+	isolators, err := resourceIsolators(composeFile.CPU, "", composeFile.Memory, "")
+	if err != nil {
+		return nil, err
+	}
+	result.Isolators = append(result.Isolators, isolators...)
+	if err := composeFile.Manifest.publishPorts(result); err != nil {
+		return nil, err
+	}
+	if err := composeFile.Manifest.applyOrdering(result); err != nil {
+		return nil, err
 	}
 	return result, nil
 }
 
-func (composeFile *ComposeFile) assertVolumes() error {
+func (composeFile *ComposeFile) assertVolumes(runner Runner) error {
 	for _, volume := range composeFile.Manifest.Volumes {
 		if volume.Kind == "" {
 			volume.Kind = "host"
 		}
 		if volume.Kind == "host" {
-			if strings.HasPrefix(volume.Source, "./") {
-				cwd, err := os.Getwd()
-				if err != nil {
-					return err
-				}
-				volume.Source = filepath.Join(cwd, volume.Source)
-			}
+			volume.Source = composeFile.ProjectPath(volume.Source)
 			if _, err := os.Stat(volume.Source); err != nil {
+				if dryRun(runner) {
+					log.Printf("dry-run: would create directory %v", volume.Source)
+					continue
+				}
 				err = os.MkdirAll(volume.Source, 0777)
 				if err != nil {
 					return err
@@ -236,12 +347,45 @@ func (composeFile *ComposeFile) assertVolumes() error {
 	return nil
 }
 
+// PrepareOptions controls how a pod gets prepared
+type PrepareOptions struct {
+	// Runner runs rkt and the commands of secrets
+	Runner Runner
+	// FetchJobs limits the number of images fetched concurrently.
+	// Values below one mean no limit.
+	FetchJobs int
+	// LockFile is the path of the lock file pinning image ids.
+	// Locking is disabled if it is empty.
+	LockFile string
+	// Frozen fails if the lock file is missing or stale instead of updating it
+	Frozen bool
+	// UpdateLock fetches the latest images and records their ids
+	UpdateLock bool
+	// SecretsDir is the directory secret files are written to,
+	// DefaultSecretsDir if empty
+	SecretsDir string
+}
+
 // Prepare fetches images and creates host volume pathes if needed
-func (composeFile *ComposeFile) Prepare(output io.Writer) error {
-	if err := composeFile.fetchImages(); err != nil {
+func (composeFile *ComposeFile) Prepare(output io.Writer, opts PrepareOptions) error {
+	digest, err := composeFile.inputDigest()
+	if err != nil {
+		return err
+	}
+	if err := composeFile.resolveImages(opts); err != nil {
+		return err
+	}
+	if err := composeFile.assertStage1(opts.Runner); err != nil {
+		return err
+	}
+	if err := composeFile.assertVolumes(opts.Runner); err != nil {
+		return err
+	}
+	secrets, err := composeFile.resolveSecrets(opts.Runner)
+	if err != nil {
 		return err
 	}
-	if err := composeFile.assertVolumes(); err != nil {
+	if err := composeFile.writeSecrets(opts.Runner, opts.SecretsDir, secrets); err != nil {
 		return err
 	}
 	log.Print("generate pod-manifest...")
@@ -249,6 +393,8 @@ func (composeFile *ComposeFile) Prepare(output io.Writer) error {
 	if err != nil {
 		return err
 	}
+	composeFile.applySecrets(manifest, opts.SecretsDir, secrets)
+	setInputHash(manifest, inputHash(digest, opts.LockFile, composeFile.imageIDs(), secrets))
 	encoder := json.NewEncoder(output)
 	err = encoder.Encode(manifest)
 	if err != nil {
@@ -0,0 +1,127 @@
+package lib
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/appc/spec/schema"
+)
+
+const testComposeYAML = `
+name: test
+cpu: 500m
+memory: 256M
+manifest:
+  apps:
+    - name: redis
+      image:
+        name: docker://redis
+      app:
+        exec: ["redis-server"]
+        memory: 128M
+        mountPoints:
+          - name: data
+            path: /data
+  volumes:
+    - name: data
+      kind: host
+      source: ./data
+`
+
+// writeComposeFile writes content to a compose file in a new temporary
+// directory, which is removed by the returned func
+func writeComposeFile(t *testing.T, content string) (string, func()) {
+	dir, err := ioutil.TempDir("", "rkt-compose-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "rkt-compose.yaml")
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return path, func() { os.RemoveAll(dir) }
+}
+
+func TestPrepareGeneratesManifest(t *testing.T) {
+	path, cleanup := writeComposeFile(t, testComposeYAML)
+	defer cleanup()
+	runner := newFakeRunner(func(cmd *Command) error {
+		if cmd.Args[0] == "fetch" {
+			fmt.Fprintln(cmd.Stdout, testImageID)
+		}
+		return nil
+	})
+
+	composeFile, err := NewComposeFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	output := &bytes.Buffer{}
+	opts := PrepareOptions{Runner: runner, FetchJobs: 1, LockFile: composeFile.LockFilePath()}
+	if err := composeFile.Prepare(output, opts); err != nil {
+		t.Fatal(err)
+	}
+	manifest := &schema.PodManifest{}
+	if err := json.Unmarshal(output.Bytes(), manifest); err != nil {
+		t.Fatalf("invalid manifest: %v", err)
+	}
+
+	if len(manifest.Apps) != 1 || manifest.Apps[0].Name != "redis" {
+		t.Fatalf("expected the app redis, got %+v", manifest.Apps)
+	}
+	app := manifest.Apps[0]
+	if app.Image.ID.String() != testImageID {
+		t.Errorf("expected image id %v, got %v", testImageID, app.Image.ID.String())
+	}
+	if app.App.Isolators.GetByName("resource/memory") == nil {
+		t.Errorf("expected a memory isolator for the app, got %+v", app.App.Isolators)
+	}
+	for _, name := range []string{"resource/cpu", "resource/memory"} {
+		found := false
+		for _, isolator := range manifest.Isolators {
+			found = found || isolator.Name.String() == name
+		}
+		if !found {
+			t.Errorf("expected pod isolator %v, got %+v", name, manifest.Isolators)
+		}
+	}
+
+	dataDir := filepath.Join(filepath.Dir(path), "data")
+	if len(manifest.Volumes) != 1 || manifest.Volumes[0].Source != dataDir {
+		t.Errorf("expected the volume source to be resolved to %v, got %+v", dataDir, manifest.Volumes)
+	}
+	if info, err := os.Stat(dataDir); err != nil || !info.IsDir() {
+		t.Errorf("expected the host volume %v to be created", dataDir)
+	}
+	if _, ok := manifest.Annotations.Get(InputHashAnnotation); !ok {
+		t.Errorf("expected the input hash annotation")
+	}
+	if _, err := ReadLockFile(opts.LockFile); err != nil {
+		t.Errorf("expected a lock file: %v", err)
+	}
+
+	calls := runner.Calls()
+	if len(calls) != 1 || calls[0] != "rkt fetch --insecure-options=image docker://redis" {
+		t.Errorf("unexpected calls %q", calls)
+	}
+}
+
+func TestNewComposeFileReportsUnknownKeys(t *testing.T) {
+	path, cleanup := writeComposeFile(t, strings.Replace(testComposeYAML, "exec:", "Exec:", 1))
+	defer cleanup()
+	_, err := NewComposeFile(path)
+	errs, ok := err.(ValidationErrors)
+	if !ok || len(errs) != 1 {
+		t.Fatalf("expected a single validation error, got %v", err)
+	}
+	if errs[0].Line != 11 || !strings.Contains(errs[0].Message, `did you mean "exec"`) {
+		t.Errorf("unexpected error %v", errs[0])
+	}
+}
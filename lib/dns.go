@@ -0,0 +1,153 @@
+package lib
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+)
+
+// hostnamePattern matches hostnames and domain names as of RFC 1123
+var hostnamePattern = regexp.MustCompile(`^([a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)(\.[a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$`)
+
+func validHostname(name string) bool {
+	return len(name) <= 253 && hostnamePattern.MatchString(name)
+}
+
+// hostFlags maps the flags of rkt run which are covered by fields of the
+// compose file to the name of the field
+var hostFlags = map[string]string{
+	"--hostname":        "hostname",
+	"--dns":             "dns",
+	"--dns-search":      "dnsSearch",
+	"--dns-opt":         "dnsOptions",
+	"--dns-domain":      "dnsDomain",
+	"--hosts-entry":     "hostsEntries",
+	"--stage1-name":     "stage1",
+	"--stage1-path":     "stage1",
+	"--stage1-hash":     "stage1",
+	"--stage1-url":      "stage1",
+	"--stage1-from-dir": "stage1",
+}
+
+// hostArgs renders hostname, dns and hosts entries as flags of rkt run
+func (composeFile *ComposeFile) hostArgs() []string {
+	args := []string{}
+	if composeFile.Hostname != "" {
+		args = append(args, "--hostname="+composeFile.Hostname)
+	}
+	for _, server := range composeFile.DNS {
+		args = append(args, "--dns="+server)
+	}
+	for _, domain := range composeFile.DNSSearch {
+		args = append(args, "--dns-search="+domain)
+	}
+	for _, option := range composeFile.DNSOptions {
+		args = append(args, "--dns-opt="+option)
+	}
+	if composeFile.DNSDomain != "" {
+		args = append(args, "--dns-domain="+composeFile.DNSDomain)
+	}
+	for _, entry := range composeFile.HostsEntries {
+		args = append(args, "--hosts-entry="+entry)
+	}
+	return args
+}
+
+// RunArgs returns the flags of rkt run set by the compose file: stage1,
+// hostname, dns and hosts entries followed by extra
+func (composeFile *ComposeFile) RunArgs() []string {
+	args := append(composeFile.stage1Args(), composeFile.hostArgs()...)
+	return append(args, composeFile.Extra...)
+}
+
+// checkHost reports invalid hostname, dns and hosts entries
+func (composeFile *ComposeFile) checkHost(report func(path, format string, args ...interface{})) {
+	if composeFile.Hostname != "" && !validHostname(composeFile.Hostname) {
+		report("hostname", "invalid hostname %q", composeFile.Hostname)
+	}
+	dnsMode := ""
+	for idx, server := range composeFile.DNS {
+		path := fmt.Sprintf("dns[%v]", idx)
+		switch {
+		case server == "host" || server == "none":
+			if len(composeFile.DNS) > 1 {
+				report(path, "dns %v can not be combined with name servers", server)
+			}
+			dnsMode = server
+		case net.ParseIP(server) == nil:
+			report(path, "invalid name server %q, expected an ip, host or none", server)
+		}
+	}
+	if dnsMode != "" && (len(composeFile.DNSSearch) > 0 || len(composeFile.DNSOptions) > 0 || composeFile.DNSDomain != "") {
+		report("dns", "dnsSearch, dnsOptions and dnsDomain can not be used with dns %v", dnsMode)
+	}
+	for idx, domain := range composeFile.DNSSearch {
+		if !validHostname(domain) {
+			report(fmt.Sprintf("dnsSearch[%v]", idx), "invalid domain %q", domain)
+		}
+	}
+	for idx, option := range composeFile.DNSOptions {
+		if option == "" || strings.ContainsAny(option, " \t,") {
+			report(fmt.Sprintf("dnsOptions[%v]", idx), "invalid dns option %q", option)
+		}
+	}
+	if composeFile.DNSDomain != "" && !validHostname(composeFile.DNSDomain) {
+		report("dnsDomain", "invalid domain %q", composeFile.DNSDomain)
+	}
+	for idx, entry := range composeFile.HostsEntries {
+		path := fmt.Sprintf("hostsEntries[%v]", idx)
+		if entry == "host" {
+			if len(composeFile.HostsEntries) > 1 {
+				report(path, "hosts entry host can not be combined with other entries")
+			}
+			continue
+		}
+		parts := strings.SplitN(entry, "=", 2)
+		switch {
+		case len(parts) != 2:
+			report(path, "invalid hosts entry %q, expected IP=HOSTNAME or host", entry)
+		case net.ParseIP(parts[0]) == nil:
+			report(path, "invalid ip %q in hosts entry", parts[0])
+		case !validHostname(parts[1]):
+			report(path, "invalid hostname %q in hosts entry", parts[1])
+		}
+	}
+}
+
+// hostConflicts warns about extra flags which set what a field already sets
+func (composeFile *ComposeFile) hostConflicts() ValidationErrors {
+	warnings := ValidationErrors{}
+	set := map[string]bool{
+		"hostname":     composeFile.Hostname != "",
+		"dns":          len(composeFile.DNS) > 0,
+		"dnsSearch":    len(composeFile.DNSSearch) > 0,
+		"dnsOptions":   len(composeFile.DNSOptions) > 0,
+		"dnsDomain":    composeFile.DNSDomain != "",
+		"hostsEntries": len(composeFile.HostsEntries) > 0,
+		"stage1":       composeFile.Stage1 != "",
+	}
+	seen := map[string]int{}
+	for _, arg := range composeFile.Extra {
+		// the same flag may be given by several files
+		n := seen[arg]
+		seen[arg]++
+		flag := strings.SplitN(arg, "=", 2)[0]
+		field, ok := hostFlags[flag]
+		if !ok || !set[field] {
+			continue
+		}
+		path := "extra"
+		file, line, idx := composeFile.locateEntry(path, arg, n)
+		if idx >= 0 {
+			path = fmt.Sprintf("extra[%v]", idx)
+		}
+		warnings = append(warnings, &ValidationError{
+			File:    file,
+			Line:    line,
+			Path:    path,
+			Message: fmt.Sprintf("%v conflicts with %v, remove it from extra", flag, field),
+		})
+	}
+	return warnings
+}
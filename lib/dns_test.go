@@ -0,0 +1,104 @@
+package lib
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testHostYAML = `
+name: test
+hostname: gitlab
+dns: [8.8.8.8, 1.1.1.1]
+dnsSearch: [example.com]
+dnsOptions: [ndots:2]
+dnsDomain: example.com
+hostsEntries: [127.0.0.1=gitlab]
+extra: [--debug, --hostname=other, --dns-search, example.org, --net=default]
+manifest:
+  apps:
+    - name: web
+      image:
+        name: web
+`
+
+func TestHostArgs(t *testing.T) {
+	path, cleanup := writeComposeFile(t, testHostYAML)
+	defer cleanup()
+	composeFile, err := NewComposeFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"--hostname=gitlab", "--dns=8.8.8.8", "--dns=1.1.1.1", "--dns-search=example.com",
+		"--dns-opt=ndots:2", "--dns-domain=example.com", "--hosts-entry=127.0.0.1=gitlab",
+		"--debug", "--hostname=other", "--dns-search", "example.org", "--net=default",
+	}
+	if args := composeFile.RunArgs(); !reflect.DeepEqual(args, expected) {
+		t.Errorf("expected %q, got %q", expected, args)
+	}
+
+	warnings := composeFile.Warnings()
+	if len(warnings) != 2 {
+		t.Fatalf("expected two conflicts, got %v", warnings)
+	}
+	for idx, expected := range []string{
+		"rkt-compose.yaml:9: extra[1]: --hostname conflicts with hostname, remove it from extra",
+		"rkt-compose.yaml:9: extra[2]: --dns-search conflicts with dnsSearch, remove it from extra",
+	} {
+		if !strings.HasSuffix(warnings[idx].Error(), expected) {
+			t.Errorf("expected %q, got %v", expected, warnings[idx])
+		}
+	}
+}
+
+func TestHostConflictsLayered(t *testing.T) {
+	path, cleanup := writeComposeFile(t, "name: test\nhostname: gitlab\nextra:\n  - --debug\n  - --hostname=base\n")
+	defer cleanup()
+	override := filepath.Join(filepath.Dir(path), "override.yaml")
+	if err := ioutil.WriteFile(override, []byte("extra:\n  - --hostname=override\n  - --hostname=base\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	composeFile, err := NewComposeFile(path, override)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"rkt-compose.yaml:5: extra[1]: --hostname conflicts with hostname, remove it from extra",
+		"override.yaml:2: extra[0]: --hostname conflicts with hostname, remove it from extra",
+		"override.yaml:3: extra[1]: --hostname conflicts with hostname, remove it from extra",
+	}
+	warnings := composeFile.Warnings()
+	if len(warnings) != len(expected) {
+		t.Fatalf("expected %v conflicts, got %v", len(expected), warnings)
+	}
+	for idx, warning := range warnings {
+		if !strings.HasSuffix(warning.Error(), expected[idx]) {
+			t.Errorf("expected %q, got %v", expected[idx], warning)
+		}
+	}
+}
+
+func TestHostValidation(t *testing.T) {
+	tests := map[string]string{
+		"hostname: -gitlab":                      `hostname: invalid hostname "-gitlab"`,
+		"dns: [host, 8.8.8.8]":                   "dns[0]: dns host can not be combined with name servers",
+		"dns: [8.8.8]":                           `dns[0]: invalid name server "8.8.8", expected an ip, host or none`,
+		"dns: [none]\ndnsDomain: example.com":    "dns: dnsSearch, dnsOptions and dnsDomain can not be used with dns none",
+		"dnsSearch: [example..com]":              `dnsSearch[0]: invalid domain "example..com"`,
+		"dnsOptions: [\"ndots: 2\"]":             `dnsOptions[0]: invalid dns option "ndots: 2"`,
+		"hostsEntries: [gitlab]":                 `hostsEntries[0]: invalid hosts entry "gitlab", expected IP=HOSTNAME or host`,
+		"hostsEntries: [localhost=gitlab]":       `hostsEntries[0]: invalid ip "localhost" in hosts entry`,
+		"hostsEntries: [host, 127.0.0.1=gitlab]": "hostsEntries[0]: hosts entry host can not be combined with other entries",
+	}
+	for fields, expected := range tests {
+		path, cleanup := writeComposeFile(t, "name: test\n"+fields+"\n")
+		_, err := NewComposeFile(path)
+		cleanup()
+		if err == nil || !strings.HasSuffix(err.Error(), expected) {
+			t.Errorf("%v: expected %q, got %v", fields, expected, err)
+		}
+	}
+}
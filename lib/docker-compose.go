@@ -0,0 +1,547 @@
+package lib
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/appc/spec/schema/types"
+	"github.com/appc/spec/schema/types/resource"
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// dockerConverter converts a docker-compose file and collects warnings
+// about everything which can not be mapped
+type dockerConverter struct {
+	composeFile *ComposeFile
+	warnings    []string
+	cpu         *resource.Quantity
+	memory      *resource.Quantity
+}
+
+func (c *dockerConverter) warn(format string, args ...interface{}) {
+	c.warnings = append(c.warnings, fmt.Sprintf(format, args...))
+}
+
+// ConvertDockerCompose reads a docker-compose file (version 2 or 3) and
+// converts it to a compose file describing a single pod.
+// Services become apps, everything which can not be mapped is returned as
+// a list of warnings.
+func ConvertDockerCompose(path string) (*ComposeFile, []string, error) {
+	bs, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	doc := map[string]interface{}{}
+	if err := yamlv3.Unmarshal(bs, &doc); err != nil {
+		return nil, nil, fmt.Errorf("%v: %v", path, err)
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	name, err := types.SanitizeACName(filepath.Base(filepath.Dir(abs)))
+	if err != nil {
+		name = "pod"
+	}
+	c := &dockerConverter{composeFile: &ComposeFile{Name: name}}
+
+	version := fmt.Sprint(doc["version"])
+	if !strings.HasPrefix(version, "2") && !strings.HasPrefix(version, "3") {
+		c.warn("unsupported docker-compose file version %q, trying anyway", version)
+	}
+	services, ok := doc["services"].(map[string]interface{})
+	if !ok {
+		return nil, nil, fmt.Errorf("%v: no services found", path)
+	}
+	for key := range doc {
+		switch key {
+		case "version", "services", "volumes":
+		default:
+			c.warn("top level key %q is not supported", key)
+		}
+	}
+	for _, name := range sortedKeys(services) {
+		service, ok := services[name].(map[string]interface{})
+		if !ok {
+			c.warn("service %v: invalid definition", name)
+			continue
+		}
+		c.convertService(name, service)
+	}
+	c.checkDependencies()
+	if c.cpu != nil {
+		c.composeFile.CPU = c.cpu.String()
+	}
+	if c.memory != nil {
+		c.composeFile.Memory = c.memory.String()
+	}
+	return c.composeFile, c.warnings, nil
+}
+
+func (c *dockerConverter) convertService(name string, service map[string]interface{}) {
+	appName, err := types.SanitizeACName(name)
+	if err != nil {
+		c.warn("service %v: can not derive an app name: %v", name, err)
+		return
+	}
+	image, _ := service["image"].(string)
+	if image == "" {
+		c.warn("service %v: services without an image (build) are not supported, skipping", name)
+		return
+	}
+	app := &RuntimeApp{
+		Name:  types.ACName(appName),
+		Image: RuntimeImage{Name: "docker://" + image},
+		App:   &App{},
+	}
+
+	entrypoint, hasEntrypoint := c.stringList(name, "entrypoint", service["entrypoint"])
+	command, hasCommand := c.stringList(name, "command", service["command"])
+	switch {
+	case hasEntrypoint:
+		app.App.Exec = append(entrypoint, command...)
+	case hasCommand:
+		c.warn("service %v: command without entrypoint replaces the entrypoint of the image", name)
+		app.App.Exec = command
+	}
+
+	for _, key := range sortedKeys(service) {
+		value := service[key]
+		switch key {
+		case "image", "entrypoint", "command":
+		case "environment":
+			c.convertEnvironment(name, app.App, value)
+		case "volumes":
+			c.convertVolumes(name, app.App, value)
+		case "ports":
+			c.convertPorts(name, app, value)
+		case "working_dir":
+			app.App.WorkingDirectory = fmt.Sprint(value)
+		case "user":
+			parts := strings.SplitN(fmt.Sprint(value), ":", 2)
+			app.App.User = parts[0]
+			if len(parts) == 2 {
+				app.App.Group = parts[1]
+			}
+		case "mem_limit":
+			c.addMemory(name, value)
+		case "cpus":
+			c.addCPU(name, value)
+		case "deploy":
+			c.convertDeploy(name, value)
+		case "restart":
+			c.convertRestart(name, fmt.Sprint(value))
+		case "depends_on":
+			c.convertDependsOn(name, app, value)
+		default:
+			c.warn("service %v: key %q is not supported", name, key)
+		}
+	}
+	c.composeFile.Manifest.Apps = append(c.composeFile.Manifest.Apps, app)
+}
+
+// stringList handles values which are either a list of strings or a single
+// string, which is split like a shell would do
+func (c *dockerConverter) stringList(service, key string, value interface{}) ([]string, bool) {
+	switch v := value.(type) {
+	case nil:
+		return nil, false
+	case string:
+		return splitWords(v), true
+	case []interface{}:
+		result := make([]string, len(v))
+		for idx, item := range v {
+			result[idx] = fmt.Sprint(item)
+		}
+		return result, true
+	}
+	c.warn("service %v: invalid %v", service, key)
+	return nil, false
+}
+
+// convertDependsOn accepts the list form and the long form of version 3,
+// conditions are ignored
+func (c *dockerConverter) convertDependsOn(service string, app *RuntimeApp, value interface{}) {
+	var services []string
+	switch deps := value.(type) {
+	case []interface{}:
+		for _, dep := range deps {
+			services = append(services, fmt.Sprint(dep))
+		}
+	case map[string]interface{}:
+		services = sortedKeys(deps)
+	default:
+		c.warn("service %v: invalid depends_on", service)
+		return
+	}
+	for _, dep := range services {
+		name, err := types.SanitizeACName(dep)
+		if err != nil {
+			c.warn("service %v: can not derive an app name for dependency %v: %v", service, dep, err)
+			continue
+		}
+		app.DependsOn = appendUnique(app.DependsOn, name)
+	}
+}
+
+// checkDependencies drops dependencies which can not be honored: the exec
+// of both apps gets wrapped, so it has to be known
+func (c *dockerConverter) checkDependencies() {
+	manifest := &c.composeFile.Manifest
+	for _, app := range manifest.Apps {
+		deps := app.DependsOn[:0]
+		for _, dep := range app.DependsOn {
+			switch other := manifest.app(types.ACName(dep)); {
+			case other == nil:
+				c.warn("service %v: dependency %v is not converted, dropping it", app.Name, dep)
+			case len(app.App.Exec) == 0 || len(other.App.Exec) == 0:
+				c.warn("service %v: dependency %v is dropped, dependencies need an entrypoint on both services", app.Name, dep)
+			default:
+				deps = append(deps, dep)
+			}
+		}
+		app.DependsOn = deps
+		if len(deps) == 0 {
+			app.DependsOn = nil
+		}
+	}
+}
+
+func (c *dockerConverter) convertEnvironment(service string, app *App, value interface{}) {
+	switch env := value.(type) {
+	case map[string]interface{}:
+		for _, name := range sortedKeys(env) {
+			if env[name] == nil {
+				// taken from the environment, just like docker-compose does
+				app.Environment.Set(name, "${"+name+"}")
+			} else {
+				app.Environment.Set(name, fmt.Sprint(env[name]))
+			}
+		}
+	case []interface{}:
+		for _, item := range env {
+			parts := strings.SplitN(fmt.Sprint(item), "=", 2)
+			if len(parts) == 1 {
+				app.Environment.Set(parts[0], "${"+parts[0]+"}")
+			} else {
+				app.Environment.Set(parts[0], parts[1])
+			}
+		}
+	default:
+		c.warn("service %v: invalid environment", service)
+	}
+}
+
+func (c *dockerConverter) convertVolumes(service string, app *App, value interface{}) {
+	volumes, ok := value.([]interface{})
+	if !ok {
+		c.warn("service %v: invalid volumes", service)
+		return
+	}
+	for idx, item := range volumes {
+		var source, target string
+		readOnly := false
+		switch v := item.(type) {
+		case string:
+			parts := strings.Split(v, ":")
+			switch len(parts) {
+			case 1:
+				target = parts[0]
+			case 2:
+				source, target = parts[0], parts[1]
+			default:
+				if len(parts) > 3 {
+					c.warn("service %v: volume %q has more than 3 fields, ignoring %q", service, v, strings.Join(parts[3:], ":"))
+				}
+				source, target = parts[0], parts[1]
+				for _, mode := range strings.Split(parts[2], ",") {
+					switch mode {
+					case "ro":
+						readOnly = true
+					case "rw":
+					default:
+						c.warn("service %v: volume mode %q is not supported", service, mode)
+					}
+				}
+			}
+		case map[string]interface{}:
+			if t, _ := v["type"].(string); t != "" && t != "bind" && t != "volume" {
+				c.warn("service %v: volume type %q is not supported, skipping", service, t)
+				continue
+			}
+			source, _ = v["source"].(string)
+			target, _ = v["target"].(string)
+			readOnly, _ = v["read_only"].(bool)
+		default:
+			c.warn("service %v: invalid volume definition", service)
+			continue
+		}
+
+		if strings.HasPrefix(source, "~") {
+			expanded, err := expandHome(source)
+			if err != nil {
+				c.warn("service %v: can not expand volume source %v: %v, skipping", service, source, err)
+				continue
+			}
+			source = expanded
+		}
+		vol := &Volume{Kind: "host", Source: source}
+		switch {
+		case source == "":
+			vol.Kind = "empty"
+			vol.Source = ""
+			vol.Name = types.ACName(fmt.Sprintf("%v-volume-%v", service, idx))
+		case strings.HasPrefix(source, "/"), strings.HasPrefix(source, "."):
+			vol.Name = types.ACName(fmt.Sprintf("%v-volume-%v", service, idx))
+		default:
+			c.warn("service %v: named volume %q is mapped to the host directory ./volumes/%v", service, source, source)
+			vol.Source = "./volumes/" + source
+			vol.Name = types.ACName(source)
+		}
+		name, err := types.SanitizeACName(string(vol.Name))
+		if err != nil {
+			c.warn("service %v: can not derive a volume name for %v: %v", service, target, err)
+			continue
+		}
+		vol.Name = types.ACName(name)
+		if readOnly {
+			vol.ReadOnly = &readOnly
+		}
+		if c.composeFile.Manifest.volume(vol.Name) == nil {
+			c.composeFile.Manifest.Volumes = append(c.composeFile.Manifest.Volumes, vol)
+		}
+		app.MountPoints = append(app.MountPoints, types.MountPoint{
+			Name:     vol.Name,
+			Path:     target,
+			ReadOnly: readOnly,
+		})
+	}
+}
+
+// expandHome replaces a leading ~ by the home directory of the current user,
+// the volume would otherwise be resolved relative to the project directory
+func expandHome(path string) (string, error) {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return "", fmt.Errorf("only the home directory of the current user is supported")
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, path[1:]), nil
+}
+
+func (c *dockerConverter) convertPorts(service string, app *RuntimeApp, value interface{}) {
+	ports, ok := value.([]interface{})
+	if !ok {
+		c.warn("service %v: invalid ports", service)
+		return
+	}
+	for _, item := range ports {
+		var hostIP, published, target, protocol string
+		switch v := item.(type) {
+		case int:
+			target = strconv.Itoa(v)
+		case string:
+			spec := v
+			protocol = "tcp"
+			if idx := strings.LastIndex(spec, "/"); idx >= 0 {
+				spec, protocol = spec[:idx], spec[idx+1:]
+			}
+			parts := strings.Split(spec, ":")
+			switch len(parts) {
+			case 1:
+				target = parts[0]
+			case 2:
+				published, target = parts[0], parts[1]
+			case 3:
+				hostIP, published, target = parts[0], parts[1], parts[2]
+			}
+		case map[string]interface{}:
+			target = fmt.Sprint(v["target"])
+			if v["published"] != nil {
+				published = fmt.Sprint(v["published"])
+			}
+			protocol, _ = v["protocol"].(string)
+		}
+		if protocol == "" {
+			protocol = "tcp"
+		}
+		containerPort, err := strconv.ParseUint(target, 10, 16)
+		if err != nil || containerPort == 0 {
+			c.warn("service %v: port %v is not supported (port ranges can not be converted)", service, item)
+			continue
+		}
+		portName := types.ACName(fmt.Sprintf("%v-%v-%v", service, protocol, containerPort))
+		if name, err := types.SanitizeACName(string(portName)); err == nil {
+			portName = types.ACName(name)
+		}
+		// a port may be published several times
+		if !hasPort(app.App.Ports, portName) {
+			app.App.Ports = append(app.App.Ports, types.Port{
+				Name:     portName,
+				Protocol: protocol,
+				Port:     uint(containerPort),
+				Count:    1,
+			})
+		}
+		if published == "" {
+			continue
+		}
+		hostPort, err := strconv.ParseUint(published, 10, 16)
+		if err != nil || hostPort == 0 {
+			c.warn("service %v: host port %v is not supported", service, published)
+			continue
+		}
+		mapping := PortMapping{HostPort: uint(hostPort), Port: target}
+		if protocol != "tcp" {
+			mapping.Protocol = protocol
+		}
+		if hostIP != "" {
+			if mapping.HostIP = net.ParseIP(hostIP); mapping.HostIP == nil {
+				c.warn("service %v: host ip %v is not supported", service, hostIP)
+				continue
+			}
+		}
+		app.Publish = append(app.Publish, mapping.String())
+	}
+}
+
+// convertRestart maps the restart setting of a service to the restart
+// policy of the pod
+func (c *dockerConverter) convertRestart(service, value string) {
+	policy := &RestartPolicy{}
+	parts := strings.SplitN(value, ":", 2)
+	switch parts[0] {
+	case "no", "always", "on-failure":
+		policy.Policy = parts[0]
+	case "unless-stopped":
+		policy.Policy = "always"
+	default:
+		c.warn("service %v: restart policy %q is not supported", service, value)
+		return
+	}
+	if len(parts) == 2 {
+		retries, err := strconv.Atoi(parts[1])
+		if err != nil {
+			c.warn("service %v: invalid restart policy %q", service, value)
+			return
+		}
+		policy.MaxRetries = retries
+	}
+	if existing := c.composeFile.Restart; existing != nil && *existing != *policy {
+		c.warn("service %v: restart policy %q differs from the one of other services, the pod uses %q", service, value, existing.Policy)
+		return
+	}
+	c.composeFile.Restart = policy
+}
+
+func (c *dockerConverter) convertDeploy(service string, value interface{}) {
+	deploy, _ := value.(map[string]interface{})
+	for _, key := range sortedKeys(deploy) {
+		if key != "resources" {
+			c.warn("service %v: key deploy.%v is not supported", service, key)
+		}
+	}
+	resources, _ := deploy["resources"].(map[string]interface{})
+	for _, key := range sortedKeys(resources) {
+		if key != "limits" {
+			c.warn("service %v: key deploy.resources.%v is not supported", service, key)
+		}
+	}
+	limits, _ := resources["limits"].(map[string]interface{})
+	for _, key := range sortedKeys(limits) {
+		switch key {
+		case "cpus":
+			c.addCPU(service, limits[key])
+		case "memory":
+			c.addMemory(service, limits[key])
+		default:
+			c.warn("service %v: key deploy.resources.limits.%v is not supported", service, key)
+		}
+	}
+}
+
+// addCPU adds the cpu limit of a service to the pod limit
+func (c *dockerConverter) addCPU(service string, value interface{}) {
+	q, err := resource.ParseQuantity(fmt.Sprint(value))
+	if err != nil {
+		c.warn("service %v: invalid cpus %v: %v", service, value, err)
+		return
+	}
+	if c.cpu == nil {
+		c.cpu = &q
+	} else {
+		c.cpu.Add(q)
+	}
+}
+
+// addMemory adds the memory limit of a service to the pod limit.
+// docker uses binary units with single letter suffixes.
+func (c *dockerConverter) addMemory(service string, value interface{}) {
+	str := strings.ToLower(fmt.Sprint(value))
+	str = strings.TrimSuffix(str, "b")
+	for suffix, unit := range map[string]string{"k": "Ki", "m": "Mi", "g": "Gi", "t": "Ti"} {
+		if strings.HasSuffix(str, suffix) {
+			str = strings.TrimSuffix(str, suffix) + unit
+			break
+		}
+	}
+	q, err := resource.ParseQuantity(str)
+	if err != nil {
+		c.warn("service %v: invalid memory limit %v: %v", service, value, err)
+		return
+	}
+	if c.memory == nil {
+		c.memory = &q
+	} else {
+		c.memory.Add(q)
+	}
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// splitWords splits str at whitespace, honoring single and double quotes
+func splitWords(str string) []string {
+	words := []string{}
+	current := &strings.Builder{}
+	inWord := false
+	var quote rune
+	for _, r := range str {
+		switch {
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote != 0:
+			current.WriteRune(r)
+		case r == '"' || r == '\'':
+			quote = r
+			inWord = true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inWord {
+				words = append(words, current.String())
+				current.Reset()
+				inWord = false
+			}
+		default:
+			current.WriteRune(r)
+			inWord = true
+		}
+	}
+	if inWord {
+		words = append(words, current.String())
+	}
+	return words
+}
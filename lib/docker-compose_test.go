@@ -0,0 +1,72 @@
+package lib
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/ghodss/yaml"
+)
+
+func TestConvertDockerCompose(t *testing.T) {
+	t.Setenv("HOME", "/home/test")
+	composeFile, warnings, err := ConvertDockerCompose("testdata/docker-compose.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bs, err := ioutil.ReadFile("testdata/docker-compose.converted.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &ComposeFile{}
+	if err := yaml.Unmarshal(bs, expected); err != nil {
+		t.Fatal(err)
+	}
+	converted, _ := json.Marshal(composeFile)
+	want, _ := json.Marshal(expected)
+	if string(converted) != string(want) {
+		t.Errorf("expected %s\ngot      %s", want, converted)
+	}
+	if err := composeFile.Validate(); err != nil {
+		t.Errorf("expected the converted file to be valid, got %v", err)
+	}
+
+	expectedWarnings := []string{
+		`top level key "networks" is not supported`,
+		`service builder: services without an image (build) are not supported, skipping`,
+		`service cache: command without entrypoint replaces the entrypoint of the image`,
+		`service db: key deploy.replicas is not supported`,
+		`service db: key deploy.resources.reservations is not supported`,
+		`service db: volume type "tmpfs" is not supported, skipping`,
+		`service web: key "healthcheck" is not supported`,
+		`service web: port 9000-9001:9000-9001 is not supported (port ranges can not be converted)`,
+		`service web: restart policy "always" differs from the one of other services, the pod uses "on-failure"`,
+		`service web: named volume "cache" is mapped to the host directory ./volumes/cache`,
+		`service web: volume "./certs:/etc/ssl:ro:z" has more than 3 fields, ignoring "z"`,
+		`service cache: dependency missing is not converted, dropping it`,
+	}
+	if len(warnings) != len(expectedWarnings) {
+		t.Fatalf("expected %v warnings, got %q", len(expectedWarnings), warnings)
+	}
+	for idx, warning := range warnings {
+		if warning != expectedWarnings[idx] {
+			t.Errorf("expected warning %q, got %q", expectedWarnings[idx], warning)
+		}
+	}
+}
+
+func TestSplitWords(t *testing.T) {
+	tests := map[string][]string{
+		"redis-server --appendonly yes": {"redis-server", "--appendonly", "yes"},
+		`-g "daemon off;"`:              {"-g", "daemon off;"},
+		`sh -c 'echo "hi there"'`:       {"sh", "-c", `echo "hi there"`},
+		"  spaced   out ":               {"spaced", "out"},
+	}
+	for str, expected := range tests {
+		words := splitWords(str)
+		if strings.Join(words, "|") != strings.Join(expected, "|") {
+			t.Errorf("%q: expected %q, got %q", str, expected, words)
+		}
+	}
+}
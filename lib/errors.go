@@ -0,0 +1,60 @@
+package lib
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Kinds of errors returned by the library. Check for them with errors.Is,
+// the underlying cause (e.g. the *ExitError of a failed rkt call) stays
+// available through errors.As.
+var (
+	// ErrInvalidComposeFile is returned if a compose file can not be read,
+	// parsed or validated
+	ErrInvalidComposeFile = errors.New("invalid compose file")
+	// ErrImageFetch is returned if at least one image could not be fetched
+	ErrImageFetch = errors.New("image fetch failed")
+	// ErrLockFile is returned if the lock file is missing or stale in
+	// frozen mode, or if a locked image resolves to another id
+	ErrLockFile = errors.New("lock file is missing or stale")
+	// ErrPodNotRunning is returned by operations which need a running pod
+	ErrPodNotRunning = errors.New("pod is not running")
+	// ErrCommandFailed is returned if rkt, systemctl or another external
+	// command failed
+	ErrCommandFailed = errors.New("command failed")
+	// ErrUnhealthy is returned if a health check found an unhealthy app
+	ErrUnhealthy = errors.New("pod is unhealthy")
+)
+
+// Error is an error of a known kind, wrapping its cause
+type Error struct {
+	Kind error
+	Err  error
+}
+
+func (err *Error) Error() string {
+	return err.Err.Error()
+}
+
+// Unwrap returns the cause of the error
+func (err *Error) Unwrap() error {
+	return err.Err
+}
+
+// Is reports whether the error is of the given kind
+func (err *Error) Is(kind error) bool {
+	return err.Kind == kind
+}
+
+// newError returns a formatted error of the given kind
+func newError(kind error, format string, args ...interface{}) error {
+	return &Error{Kind: kind, Err: fmt.Errorf(format, args...)}
+}
+
+// wrapError marks err as being of the given kind, nil stays nil
+func wrapError(kind error, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &Error{Kind: kind, Err: err}
+}
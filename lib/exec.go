@@ -0,0 +1,46 @@
+package lib
+
+import (
+	"errors"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// DefaultExecCommand is run by Exec if no command is given
+var DefaultExecCommand = []string{"/bin/sh"}
+
+// Exec runs command inside app of the pod whose uuid is saved in uuidFile
+// and returns the exit code of the command.
+// If stdin is a terminal it is handed to the command, which makes it the
+// controlling tty of e.g. an interactive shell. Interrupts are then left to
+// the command instead of aborting rkt-compose.
+func Exec(runner Runner, uuidFile, app string, command []string) (int, error) {
+	uuid, err := readPodUUID(uuidFile)
+	if err != nil {
+		return 0, err
+	}
+	if len(command) == 0 {
+		command = DefaultExecCommand
+	}
+	if IsTerminal(os.Stdin) {
+		signal.Ignore(os.Interrupt, syscall.SIGQUIT)
+		defer signal.Reset(os.Interrupt, syscall.SIGQUIT)
+	}
+	args := append([]string{"enter", "--app=" + app, uuid}, command...)
+	err = runAttached(runner, "rkt", args...)
+	var exitErr *ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.Code, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return 0, nil
+}
+
+// IsTerminal reports whether f is a terminal
+func IsTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
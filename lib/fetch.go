@@ -0,0 +1,186 @@
+package lib
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/appc/spec/schema/types"
+)
+
+// An ImageFetchFailure describes a single image which could not be fetched
+type ImageFetchFailure struct {
+	Image  string
+	Err    error
+	Output string
+}
+
+// FetchError lists all images which could not be fetched
+type FetchError struct {
+	Failures []*ImageFetchFailure
+}
+
+func (err *FetchError) Error() string {
+	msgs := make([]string, len(err.Failures))
+	for idx, failure := range err.Failures {
+		msgs[idx] = fmt.Sprintf("%v: %v", failure.Image, failure.Err)
+		if output := lastLine(failure.Output); output != "" {
+			msgs[idx] += ": " + output
+		}
+	}
+	return fmt.Sprintf("failed to fetch %v image(s):\n  %v", len(err.Failures), strings.Join(msgs, "\n  "))
+}
+
+// Is makes fetch errors match ErrImageFetch
+func (err *FetchError) Is(kind error) bool {
+	return kind == ErrImageFetch
+}
+
+// Unwrap returns the causes of all failures
+func (err *FetchError) Unwrap() []error {
+	errs := make([]error, len(err.Failures))
+	for idx, failure := range err.Failures {
+		errs[idx] = failure.Err
+	}
+	return errs
+}
+
+// imageURL returns the url of an image as understood by rkt fetch
+func (image *RuntimeImage) imageURL() string {
+	url := image.Name
+	for _, label := range image.Labels {
+		url += fmt.Sprintf(",%v=%v", label.Name, label.Value)
+	}
+	return url
+}
+
+// fetchImages fetches all images without an id, at most jobs at a time.
+// Images shared by several apps are fetched only once. The pull policy is
+// passed on to rkt if given.
+func (composeFile *ComposeFile) fetchImages(runner Runner, jobs int, pullPolicy string) error {
+	urls := []string{}
+	apps := map[string][]*RuntimeApp{}
+	for _, app := range composeFile.Manifest.Apps {
+		if !app.Image.ID.Empty() {
+			continue
+		}
+		url := app.Image.imageURL()
+		if _, ok := apps[url]; !ok {
+			urls = append(urls, url)
+		}
+		apps[url] = append(apps[url], app)
+	}
+	if len(urls) == 0 {
+		return nil
+	}
+	if jobs < 1 || jobs > len(urls) {
+		jobs = len(urls)
+	}
+	log.Printf("fetch %v image(s), %v at a time...", len(urls), jobs)
+
+	var (
+		wg       sync.WaitGroup
+		mutex    sync.Mutex
+		done     int
+		failures = make([]*ImageFetchFailure, len(urls))
+		slots    = make(chan struct{}, jobs)
+	)
+	for idx, url := range urls {
+		wg.Add(1)
+		go func(idx int, url string) {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+			log.Printf("fetching image %v...", url)
+			start := time.Now()
+			hash, output, err := fetchImage(runner, url, pullPolicy)
+			mutex.Lock()
+			defer mutex.Unlock()
+			done++
+			if err != nil {
+				failures[idx] = &ImageFetchFailure{Image: url, Err: err, Output: output}
+				log.Printf("[%v/%v] failed to fetch image %v: %v", done, len(urls), url, err)
+				return
+			}
+			for _, app := range apps[url] {
+				app.Image.ID = *hash
+			}
+			if hash.String() == unknownImageID {
+				log.Printf("[%v/%v] image %v would be fetched, its id is unknown yet.", done, len(urls), url)
+				return
+			}
+			log.Printf("[%v/%v] fetched image %v with id %v in %v.", done, len(urls), url, hash, time.Since(start).Round(time.Second))
+		}(idx, url)
+	}
+	wg.Wait()
+
+	err := &FetchError{}
+	for _, failure := range failures {
+		if failure != nil {
+			err.Failures = append(err.Failures, failure)
+		}
+	}
+	if len(err.Failures) > 0 {
+		return err
+	}
+	return nil
+}
+
+// unknownImageID stands in for the ids of images which would be fetched
+// in dry-run mode
+const unknownImageID = "sha512-00000000000000000000000000000000"
+
+// fetchImage runs rkt fetch for a single image and returns its id.
+// The output of rkt is returned as well to give context on errors.
+// In dry-run mode only images already in the store are resolved, all
+// others get unknownImageID.
+func fetchImage(runner Runner, url, pullPolicy string) (*types.Hash, string, error) {
+	if dryRun(runner) && pullPolicy != "update" {
+		cmd := fetchCommand(url, "never")
+		cmd.Query = true
+		if hash, _, err := runFetch(runner, cmd); err == nil {
+			return hash, "", nil
+		}
+	}
+	hash, output, err := runFetch(runner, fetchCommand(url, pullPolicy))
+	if err != nil && dryRun(runner) {
+		hash, _ = types.NewHash(unknownImageID)
+		return hash, "", nil
+	}
+	return hash, output, err
+}
+
+func fetchCommand(url, pullPolicy string) *Command {
+	args := []string{"fetch"}
+	if pullPolicy != "" {
+		args = append(args, "--pull-policy="+pullPolicy)
+	}
+	if strings.HasPrefix(url, "docker://") {
+		args = append(args, "--insecure-options=image")
+	}
+	args = append(args, url)
+	return &Command{Name: "rkt", Args: args}
+}
+
+func runFetch(runner Runner, cmd *Command) (*types.Hash, string, error) {
+	stdout := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+	cmd.Stdout, cmd.Stderr = stdout, stderr
+	if err := runner.Run(context.Background(), cmd); err != nil {
+		return nil, stderr.String(), err
+	}
+	hash, err := types.NewHash(lastLine(stdout.String()))
+	if err != nil {
+		return nil, stderr.String(), fmt.Errorf("unexpected output of rkt fetch: %v", err)
+	}
+	return hash, stderr.String(), nil
+}
+
+func lastLine(str string) string {
+	lines := strings.Split(strings.TrimSpace(str), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
@@ -0,0 +1,141 @@
+package lib
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/appc/spec/schema/types"
+)
+
+const testImageID = "sha512-0123456789abcdef0123456789abcdef"
+
+func testComposeFile(images ...string) *ComposeFile {
+	composeFile := &ComposeFile{Name: "test"}
+	for idx, image := range images {
+		composeFile.Manifest.Apps = append(composeFile.Manifest.Apps, &RuntimeApp{
+			Name:  types.ACName(fmt.Sprintf("app%v", idx)),
+			Image: RuntimeImage{Name: image},
+		})
+	}
+	return composeFile
+}
+
+func TestFetchImages(t *testing.T) {
+	runner := newFakeRunner(func(cmd *Command) error {
+		fmt.Fprintln(cmd.Stderr, "Downloading...")
+		fmt.Fprintln(cmd.Stdout, testImageID)
+		return nil
+	})
+	composeFile := testComposeFile("docker://redis", "coreos.com/etcd:v3.1.7", "docker://redis")
+	if err := composeFile.fetchImages(runner, 2, "update"); err != nil {
+		t.Fatal(err)
+	}
+	for _, app := range composeFile.Manifest.Apps {
+		if app.Image.ID.String() != testImageID {
+			t.Errorf("app %v: expected image id %v, got %v", app.Name, testImageID, app.Image.ID.String())
+		}
+	}
+	calls := runner.Calls()
+	if len(calls) != 2 {
+		t.Fatalf("expected each image to be fetched once, got %q", calls)
+	}
+	for _, expected := range []string{
+		"rkt fetch --pull-policy=update --insecure-options=image docker://redis",
+		"rkt fetch --pull-policy=update coreos.com/etcd:v3.1.7",
+	} {
+		if calls[0] != expected && calls[1] != expected {
+			t.Errorf("expected call %q, got %q", expected, calls)
+		}
+	}
+}
+
+func TestFetchImagesSkipsPinnedImages(t *testing.T) {
+	runner := newFakeRunner(nil)
+	composeFile := testComposeFile("docker://redis")
+	id, _ := types.NewHash(testImageID)
+	composeFile.Manifest.Apps[0].Image.ID = *id
+	if err := composeFile.fetchImages(runner, 1, ""); err != nil {
+		t.Fatal(err)
+	}
+	if calls := runner.Calls(); len(calls) != 0 {
+		t.Errorf("expected no calls, got %q", calls)
+	}
+}
+
+func TestFetchImagesBadOutput(t *testing.T) {
+	runner := newFakeRunner(func(cmd *Command) error {
+		fmt.Fprintln(cmd.Stdout, "not a hash")
+		return nil
+	})
+	err := testComposeFile("docker://redis").fetchImages(runner, 1, "")
+	fetchErr, ok := err.(*FetchError)
+	if !ok {
+		t.Fatalf("expected a *FetchError, got %#v", err)
+	}
+	if len(fetchErr.Failures) != 1 || !strings.Contains(fetchErr.Failures[0].Err.Error(), "unexpected output of rkt fetch") {
+		t.Errorf("unexpected failures: %v", err)
+	}
+}
+
+func TestFetchImagesReportsAllFailures(t *testing.T) {
+	runner := newFakeRunner(func(cmd *Command) error {
+		url := cmd.Args[len(cmd.Args)-1]
+		if strings.Contains(url, "missing") {
+			fmt.Fprintln(cmd.Stderr, "error: image not found")
+			return exitStatus(1)
+		}
+		fmt.Fprintln(cmd.Stdout, testImageID)
+		return nil
+	})
+	composeFile := testComposeFile("docker://missing-a", "docker://redis", "docker://missing-b")
+	err := composeFile.fetchImages(runner, 3, "")
+	fetchErr, ok := err.(*FetchError)
+	if !ok {
+		t.Fatalf("expected a *FetchError, got %#v", err)
+	}
+	if len(fetchErr.Failures) != 2 {
+		t.Fatalf("expected 2 failures, got %v", err)
+	}
+	for idx, image := range []string{"docker://missing-a", "docker://missing-b"} {
+		if fetchErr.Failures[idx].Image != image {
+			t.Errorf("expected failure %v to be %v, got %v", idx, image, fetchErr.Failures[idx].Image)
+		}
+	}
+	var exitErr *ExitError
+	if !errors.Is(err, ErrImageFetch) || !errors.As(err, &exitErr) || exitErr.Code != 1 {
+		t.Errorf("expected ErrImageFetch wrapping the exit status, got %#v", err)
+	}
+	if !strings.Contains(err.Error(), "image not found") {
+		t.Errorf("expected the output of rkt in the error, got %v", err)
+	}
+	if composeFile.Manifest.Apps[1].Image.ID.String() != testImageID {
+		t.Errorf("expected the successful fetch to set the image id")
+	}
+}
+
+func TestFetchImagesDryRun(t *testing.T) {
+	runner := newFakeRunner(func(cmd *Command) error {
+		if strings.Contains(cmd.String(), "docker://redis") {
+			fmt.Fprintln(cmd.Stdout, testImageID)
+			return nil
+		}
+		return exitStatus(1)
+	})
+	composeFile := testComposeFile("docker://redis", "docker://postgres")
+	if err := composeFile.fetchImages(&DryRunner{Runner: runner}, 1, ""); err != nil {
+		t.Fatal(err)
+	}
+	if id := composeFile.Manifest.Apps[0].Image.ID.String(); id != testImageID {
+		t.Errorf("expected the stored image to be resolved, got %v", id)
+	}
+	if id := composeFile.Manifest.Apps[1].Image.ID.String(); id != unknownImageID {
+		t.Errorf("expected a placeholder id for the missing image, got %v", id)
+	}
+	for _, call := range runner.Calls() {
+		if !strings.Contains(call, "--pull-policy=never") {
+			t.Errorf("expected only queries of the store, got %q", call)
+		}
+	}
+}
@@ -0,0 +1,428 @@
+package lib
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// PodHealthFile is the name of the file the results of health checks are
+// saved to
+const PodHealthFile = ".pod-health.json"
+
+// Health states of an app
+const (
+	HealthStarting  = "starting"
+	HealthHealthy   = "healthy"
+	HealthUnhealthy = "unhealthy"
+)
+
+// A Healthcheck tells whether a running app is healthy.
+// Exactly one of Exec, HTTP and TCP has to be given. Checks run on the
+// host: exec checks through rkt enter, http and tcp checks against the IP of
+// the pod.
+type Healthcheck struct {
+	// Exec is a command run inside the app, it exits with 0 if the app is healthy
+	Exec []string `json:"exec,omitempty" yaml:"exec,omitempty"`
+	// HTTP is an url which responds with a 2xx or 3xx status if the app is
+	// healthy. The host defaults to the IP of the pod, e.g. http://:8080/health
+	HTTP string `json:"http,omitempty" yaml:"http,omitempty"`
+	// TCP is a port of the pod which accepts connections if the app is healthy
+	TCP int `json:"tcp,omitempty" yaml:"tcp,omitempty"`
+	// Interval is the delay between checks when watching (default 30s)
+	Interval string `json:"interval,omitempty" yaml:"interval,omitempty"`
+	// Timeout limits the duration of a single check (default 10s)
+	Timeout string `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+	// Retries is the number of consecutive failures after which the app is
+	// unhealthy (default 3)
+	Retries int `json:"retries,omitempty" yaml:"retries,omitempty"`
+	// Restart restarts the unit of the pod once the app is unhealthy
+	Restart *bool `json:"restart,omitempty" yaml:"restart,omitempty"`
+}
+
+func (check *Healthcheck) merge(other *Healthcheck) {
+	if len(other.Exec) > 0 || other.HTTP != "" || other.TCP != 0 {
+		check.Exec, check.HTTP, check.TCP = other.Exec, other.HTTP, other.TCP
+	}
+	if other.Interval != "" {
+		check.Interval = other.Interval
+	}
+	if other.Timeout != "" {
+		check.Timeout = other.Timeout
+	}
+	if other.Retries != 0 {
+		check.Retries = other.Retries
+	}
+	if other.Restart != nil {
+		check.Restart = other.Restart
+	}
+}
+
+// check validates the healthcheck
+func (check *Healthcheck) check() error {
+	probes := 0
+	for _, set := range []bool{len(check.Exec) > 0, check.HTTP != "", check.TCP != 0} {
+		if set {
+			probes++
+		}
+	}
+	if probes != 1 {
+		return fmt.Errorf("exactly one of exec, http and tcp must be specified")
+	}
+	if check.TCP < 0 || check.TCP > 65535 {
+		return fmt.Errorf("invalid tcp port %v", check.TCP)
+	}
+	if check.HTTP != "" {
+		if u, err := url.Parse(check.HTTP); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return fmt.Errorf("invalid http url %q", check.HTTP)
+		}
+	}
+	if check.Retries < 0 {
+		return fmt.Errorf("retries must not be negative")
+	}
+	if _, err := check.interval(); err != nil {
+		return err
+	}
+	_, err := check.timeout()
+	return err
+}
+
+func (check *Healthcheck) interval() (time.Duration, error) {
+	return parseDuration("interval", check.Interval, 30*time.Second)
+}
+
+func (check *Healthcheck) timeout() (time.Duration, error) {
+	return parseDuration("timeout", check.Timeout, 10*time.Second)
+}
+
+func (check *Healthcheck) retries() int {
+	if check.Retries == 0 {
+		return 3
+	}
+	return check.Retries
+}
+
+// AppHealth is the result of the health checks of an app
+type AppHealth struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	// Failures counts the consecutive failed checks
+	Failures  int       `json:"failures"`
+	CheckedAt time.Time `json:"checkedAt"`
+	// Output describes why the last check failed
+	Output string `json:"output,omitempty"`
+}
+
+// PodHealth collects the results of the health checks of a pod
+type PodHealth struct {
+	UUID string       `json:"uuid"`
+	Apps []*AppHealth `json:"apps"`
+}
+
+// ReadPodHealth reads the results saved in healthFile. Results of another
+// pod than the one with the given uuid are dropped.
+func ReadPodHealth(healthFile, uuid string) (*PodHealth, error) {
+	health := &PodHealth{UUID: uuid, Apps: []*AppHealth{}}
+	bs, err := ioutil.ReadFile(healthFile)
+	if os.IsNotExist(err) {
+		return health, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	saved := &PodHealth{}
+	if err := json.Unmarshal(bs, saved); err != nil {
+		return nil, fmt.Errorf("can not parse %v: %v", healthFile, err)
+	}
+	if saved.UUID == uuid {
+		health.Apps = saved.Apps
+	}
+	return health, nil
+}
+
+// write saves the results to healthFile
+func (health *PodHealth) write(runner Runner, healthFile string) error {
+	if dryRun(runner) {
+		log.Printf("dry-run: would write health results %v", healthFile)
+		return nil
+	}
+	bs, err := json.MarshalIndent(health, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(healthFile, append(bs, '\n'), 0644)
+}
+
+// App returns the results of the app with the given name or nil
+func (health *PodHealth) App(name string) *AppHealth {
+	for _, app := range health.Apps {
+		if app.Name == name {
+			return app
+		}
+	}
+	return nil
+}
+
+// Err returns an error of kind ErrUnhealthy naming the unhealthy apps, or
+// nil if there are none
+func (health *PodHealth) Err() error {
+	unhealthy := []string{}
+	for _, app := range health.Apps {
+		if app.Status == HealthUnhealthy {
+			unhealthy = append(unhealthy, app.Name)
+		}
+	}
+	if len(unhealthy) == 0 {
+		return nil
+	}
+	return newError(ErrUnhealthy, "unhealthy app(s): %v", strings.Join(unhealthy, ", "))
+}
+
+// record adds the result of a check of app
+func (health *PodHealth) record(name string, check *Healthcheck, err error, now time.Time) *AppHealth {
+	app := health.App(name)
+	if app == nil {
+		app = &AppHealth{Name: name}
+		health.Apps = append(health.Apps, app)
+	}
+	app.CheckedAt = now
+	if err == nil {
+		app.Status, app.Failures, app.Output = HealthHealthy, 0, ""
+		return app
+	}
+	app.Failures++
+	app.Output = err.Error()
+	if app.Failures >= check.retries() {
+		app.Status = HealthUnhealthy
+	} else if app.Status == "" {
+		app.Status = HealthStarting
+	}
+	return app
+}
+
+// WriteTable prints the results in a human readable form
+func (health *PodHealth) WriteTable(output io.Writer) error {
+	w := tabwriter.NewWriter(output, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "APP\tHEALTH\tFAILURES\tCHECKED\tOUTPUT")
+	for _, app := range health.Apps {
+		fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\n",
+			app.Name, app.Status, app.Failures, app.CheckedAt.Format(time.RFC3339), orDash(app.Output))
+	}
+	return w.Flush()
+}
+
+// HealthChecker runs health checks against a running pod
+type HealthChecker struct {
+	UUID string
+	// IP is the address of the pod used by http and tcp checks
+	IP string
+	// Runner runs rkt enter and restarts the pod
+	Runner Runner
+}
+
+// NewHealthChecker returns a checker for the pod whose uuid is saved in
+// uuidFile, using its first IP
+func NewHealthChecker(runner Runner, uuidFile string) (*HealthChecker, error) {
+	uuid, err := readPodUUID(uuidFile)
+	if err != nil {
+		return nil, err
+	}
+	pod := &rktPod{}
+	if err := rktJSON(runner, pod, "status", "--format=json", uuid); err != nil {
+		return nil, err
+	}
+	if pod.State != "running" {
+		return nil, newError(ErrPodNotRunning, "pod %v is %v", uuid, pod.State)
+	}
+	checker := &HealthChecker{UUID: uuid, Runner: runner}
+	if len(pod.Networks) > 0 {
+		checker.IP = pod.Networks[0].IP
+	}
+	return checker, nil
+}
+
+// Check runs check against app, a nil error means the app is healthy
+func (checker *HealthChecker) Check(app string, check *Healthcheck) error {
+	timeout, err := check.timeout()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if len(check.Exec) > 0 {
+		return checker.checkExec(ctx, app, check.Exec)
+	}
+	if checker.IP == "" {
+		return fmt.Errorf("the pod has no ip")
+	}
+	if check.TCP != 0 {
+		conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", net.JoinHostPort(checker.IP, strconv.Itoa(check.TCP)))
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+	return checker.checkHTTP(ctx, check.HTTP)
+}
+
+func (checker *HealthChecker) checkExec(ctx context.Context, app string, command []string) error {
+	output := &bytes.Buffer{}
+	err := checker.Runner.Run(ctx, &Command{
+		Name:   "rkt",
+		Args:   append([]string{"enter", "--app=" + app, checker.UUID}, command...),
+		Stdout: output,
+		Stderr: output,
+		Query:  true,
+	})
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("timed out")
+	}
+	if err != nil {
+		if msg := lastLine(output.String()); msg != "" {
+			return fmt.Errorf("%v: %v", err, msg)
+		}
+	}
+	return err
+}
+
+func (checker *HealthChecker) checkHTTP(ctx context.Context, rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	if u.Hostname() == "" {
+		if port := u.Port(); port != "" {
+			u.Host = net.JoinHostPort(checker.IP, port)
+		} else {
+			u.Host = checker.IP
+		}
+	}
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 400 {
+		return fmt.Errorf("GET %v: %v", u, resp.Status)
+	}
+	return nil
+}
+
+// healthchecks returns the apps which have a healthcheck
+func (composeFile *ComposeFile) healthchecks() []*RuntimeApp {
+	apps := []*RuntimeApp{}
+	for _, app := range composeFile.Manifest.Apps {
+		if app.Healthcheck != nil {
+			apps = append(apps, app)
+		}
+	}
+	return apps
+}
+
+// CheckHealth runs the health checks of all apps once. The consecutive
+// failures counted so far are read from healthFile, which gets updated with
+// the results. If an app becomes unhealthy and its healthcheck asks for it,
+// the unit of the pod is restarted.
+func CheckHealth(runner Runner, composeFile *ComposeFile, uuidFile, healthFile string) (*PodHealth, error) {
+	checker, err := NewHealthChecker(runner, uuidFile)
+	if err != nil {
+		return nil, err
+	}
+	return composeFile.checkApps(checker, healthFile, composeFile.healthchecks())
+}
+
+// checkApps runs the health checks of apps concurrently
+func (composeFile *ComposeFile) checkApps(checker *HealthChecker, healthFile string, apps []*RuntimeApp) (*PodHealth, error) {
+	health, err := ReadPodHealth(healthFile, checker.UUID)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]error, len(apps))
+	wg := &sync.WaitGroup{}
+	for idx, app := range apps {
+		wg.Add(1)
+		go func(idx int, app *RuntimeApp) {
+			defer wg.Done()
+			results[idx] = checker.Check(app.Name.String(), app.Healthcheck)
+		}(idx, app)
+	}
+	wg.Wait()
+	now := time.Now()
+	restart := []string{}
+	for idx, app := range apps {
+		result := health.record(app.Name.String(), app.Healthcheck, results[idx], now)
+		if result.Status == HealthUnhealthy && boolValue(app.Healthcheck.Restart) {
+			restart = append(restart, result.Name)
+		}
+	}
+	if err := health.write(checker.Runner, healthFile); err != nil {
+		return nil, err
+	}
+	if len(restart) > 0 {
+		log.Printf("app(s) %v unhealthy, restarting pod %v", strings.Join(restart, ", "), composeFile.Name)
+		if err := Restart(checker.Runner, composeFile.Name); err != nil {
+			return health, err
+		}
+	}
+	return health, nil
+}
+
+// WatchHealth runs the health checks of all apps, each at its interval,
+// until stop is closed. Results are saved to healthFile. Checks are paused
+// while the pod is not running.
+func WatchHealth(runner Runner, composeFile *ComposeFile, uuidFile, healthFile string, stop <-chan struct{}) error {
+	apps := composeFile.healthchecks()
+	if len(apps) == 0 {
+		return fmt.Errorf("pod %v has no healthchecks", composeFile.Name)
+	}
+	next := make([]time.Time, len(apps))
+	for {
+		now := time.Now()
+		due := []*RuntimeApp{}
+		wait := time.Duration(-1)
+		for idx, app := range apps {
+			interval, err := app.Healthcheck.interval()
+			if err != nil {
+				return err
+			}
+			if !now.Before(next[idx]) {
+				due = append(due, app)
+				next[idx] = now.Add(interval)
+			}
+			if until := next[idx].Sub(now); wait < 0 || until < wait {
+				wait = until
+			}
+		}
+		if len(due) > 0 {
+			checker, err := NewHealthChecker(runner, uuidFile)
+			if err == nil {
+				_, err = composeFile.checkApps(checker, healthFile, due)
+			}
+			if err != nil {
+				log.Print(err)
+			}
+		}
+		select {
+		case <-stop:
+			return nil
+		case <-time.After(wait):
+		}
+	}
+}
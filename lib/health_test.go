@@ -0,0 +1,146 @@
+package lib
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/appc/spec/schema/types"
+)
+
+func TestPodHealthRecord(t *testing.T) {
+	health := &PodHealth{}
+	check := &Healthcheck{TCP: 80, Retries: 2}
+	failure := errors.New("connection refused")
+	now := time.Now()
+	steps := []struct {
+		err      error
+		status   string
+		failures int
+	}{
+		{failure, HealthStarting, 1},
+		{nil, HealthHealthy, 0},
+		{failure, HealthHealthy, 1},
+		{failure, HealthUnhealthy, 2},
+		{failure, HealthUnhealthy, 3},
+		{nil, HealthHealthy, 0},
+	}
+	for idx, step := range steps {
+		app := health.record("web", check, step.err, now)
+		if app.Status != step.status || app.Failures != step.failures {
+			t.Errorf("step %v: expected %v with %v failures, got %v with %v", idx, step.status, step.failures, app.Status, app.Failures)
+		}
+		if (health.Err() != nil) != (step.status == HealthUnhealthy) {
+			t.Errorf("step %v: unexpected error %v", idx, health.Err())
+		}
+	}
+	health.record("web", check, failure, now)
+	health.record("web", check, failure, now)
+	if err := health.Err(); !errors.Is(err, ErrUnhealthy) || err.Error() != "unhealthy app(s): web" {
+		t.Errorf("expected ErrUnhealthy, got %v", err)
+	}
+}
+
+func TestHealthCheckerProbes(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/health" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+	_, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+	tcpPort, _ := strconv.Atoi(port)
+	runner := newFakeRunner(func(cmd *Command) error {
+		fmt.Fprintln(cmd.Stderr, "no such file")
+		return exitStatus(1)
+	})
+	checker := &HealthChecker{UUID: "1234", IP: "127.0.0.1", Runner: runner}
+
+	tests := []struct {
+		check   *Healthcheck
+		healthy bool
+	}{
+		{&Healthcheck{HTTP: "http://:" + port + "/health"}, true},
+		{&Healthcheck{HTTP: "http://:" + port + "/broken"}, false},
+		{&Healthcheck{TCP: tcpPort}, true},
+	}
+	for _, test := range tests {
+		if err := checker.Check("web", test.check); (err == nil) != test.healthy {
+			t.Errorf("%v: expected healthy=%v, got %v", test.check, test.healthy, err)
+		}
+	}
+
+	err := checker.Check("web", &Healthcheck{Exec: []string{"test", "-e", "/ready"}})
+	if err == nil || !strings.Contains(err.Error(), "no such file") {
+		t.Errorf("expected the output of the failed check, got %v", err)
+	}
+	if calls := runner.Calls(); len(calls) != 1 || calls[0] != "rkt enter --app=web 1234 test -e /ready" {
+		t.Errorf("unexpected calls %q", calls)
+	}
+}
+
+func TestCheckAppsCountsFailures(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rkt-compose-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	healthFile := filepath.Join(dir, PodHealthFile)
+	runner := newFakeRunner(func(cmd *Command) error {
+		switch {
+		case cmd.Name == "rkt":
+			return exitStatus(1)
+		case cmd.Args[0] == "show":
+			fmt.Fprintln(cmd.Stdout, "LoadState=loaded\nActiveState=active")
+		}
+		return nil
+	})
+	restart := true
+	composeFile := &ComposeFile{Name: "test", Manifest: PodManifest{Apps: []*RuntimeApp{
+		{Name: "web", Healthcheck: &Healthcheck{Exec: []string{"true"}, Retries: 2, Restart: &restart}},
+		{Name: "db"},
+	}}}
+	checker := &HealthChecker{UUID: "1234", Runner: runner}
+
+	for round := 1; round <= 2; round++ {
+		health, err := composeFile.checkApps(checker, healthFile, composeFile.healthchecks())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(health.Apps) != 1 || health.Apps[0].Failures != round {
+			t.Fatalf("round %v: expected %v failures of web, got %+v", round, round, health.Apps)
+		}
+	}
+	if calls := runner.Calls(); calls[len(calls)-1] != "systemctl restart test.service" {
+		t.Errorf("expected the pod to be restarted, got %q", calls)
+	}
+	if health, _ := ReadPodHealth(healthFile, "other"); len(health.Apps) != 0 {
+		t.Errorf("expected results of another pod to be dropped, got %+v", health.Apps)
+	}
+}
+
+func TestHealthcheckValidation(t *testing.T) {
+	tests := map[string]*Healthcheck{
+		"exactly one of exec, http and tcp must be specified": {TCP: 80, HTTP: "http://:80/"},
+		`invalid http url ":80/health"`:                       {HTTP: ":80/health"},
+		`invalid interval "often"`:                            {TCP: 80, Interval: "often"},
+	}
+	for expected, check := range tests {
+		composeFile := &ComposeFile{Manifest: PodManifest{Apps: []*RuntimeApp{
+			{Name: types.ACName("web"), Image: RuntimeImage{Name: "web"}, Healthcheck: check},
+		}}}
+		err := composeFile.Validate()
+		if err == nil || !strings.HasSuffix(err.Error(), "manifest.apps[web].healthcheck: "+expected) {
+			t.Errorf("expected %q, got %v", expected, err)
+		}
+	}
+}
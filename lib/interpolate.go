@@ -0,0 +1,220 @@
+package lib
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// variableLookup resolves the value of a variable used in a compose file
+type variableLookup func(name string) (string, bool)
+
+// newVariableLookup returns a lookup which prefers the process environment
+// and falls back to the given variables (usually read from a .env file).
+// Every variable looked up is recorded in used, unset ones as nil.
+func newVariableLookup(fallback map[string]string, used map[string]*string) variableLookup {
+	return func(name string) (string, bool) {
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			value, ok = fallback[name]
+		}
+		if ok {
+			used[name] = &value
+		} else {
+			used[name] = nil
+		}
+		return value, ok
+	}
+}
+
+// Variables returns all variables referenced by the compose files and their
+// values. Variables which were not set map to nil.
+func (composeFile *ComposeFile) Variables() map[string]*string {
+	vars := map[string]*string{}
+	for _, source := range composeFile.sources {
+		for name, value := range source.variables {
+			vars[name] = value
+		}
+	}
+	return vars
+}
+
+// interpolateNode substitutes variables in all scalar values below node.
+// All errors are collected and returned together with their field path.
+func interpolateNode(node *yamlv3.Node, path string, lookup variableLookup) ValidationErrors {
+	errs := ValidationErrors{}
+	walkScalars(node, path, func(scalar *yamlv3.Node, path string) {
+		if !strings.Contains(scalar.Value, "$") {
+			return
+		}
+		value, err := interpolate(scalar.Value, lookup)
+		if err != nil {
+			errs = append(errs, &ValidationError{Line: scalar.Line, Path: path, Message: err.Error()})
+			return
+		}
+		if value != scalar.Value && scalar.Style == 0 {
+			// let the substituted value resolve to its natural type,
+			// so that e.g. ports can be given by variables
+			scalar.Tag = ""
+		}
+		scalar.Value = value
+	})
+	return errs
+}
+
+// walkScalars calls fn for every scalar value (not mapping keys) below node
+func walkScalars(node *yamlv3.Node, path string, fn func(node *yamlv3.Node, path string)) {
+	switch node.Kind {
+	case yamlv3.DocumentNode:
+		for _, child := range node.Content {
+			walkScalars(child, path, fn)
+		}
+	case yamlv3.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			walkScalars(node.Content[i+1], joinFieldPath(path, node.Content[i].Value), fn)
+		}
+	case yamlv3.SequenceNode:
+		for idx, child := range node.Content {
+			walkScalars(child, fmt.Sprintf("%v[%v]", path, idx), fn)
+		}
+	case yamlv3.ScalarNode:
+		fn(node, path)
+	}
+}
+
+func joinFieldPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// interpolate substitutes ${VAR}, ${VAR:-default} and ${VAR:?error} in str.
+// $$ can be used to get a literal $.
+func interpolate(str string, lookup variableLookup) (string, error) {
+	result := &strings.Builder{}
+	for {
+		idx := strings.Index(str, "$")
+		if idx < 0 || idx == len(str)-1 {
+			result.WriteString(str)
+			return result.String(), nil
+		}
+		result.WriteString(str[:idx])
+		str = str[idx:]
+		switch str[1] {
+		case '$':
+			result.WriteByte('$')
+			str = str[2:]
+		case '{':
+			end := strings.Index(str, "}")
+			if end < 0 {
+				return "", fmt.Errorf("unterminated variable expression in %q", str)
+			}
+			value, err := substitute(str[2:end], lookup)
+			if err != nil {
+				return "", err
+			}
+			result.WriteString(value)
+			str = str[end+1:]
+		default:
+			result.WriteByte('$')
+			str = str[1:]
+		}
+	}
+}
+
+func substitute(expr string, lookup variableLookup) (string, error) {
+	name, op, arg := expr, "", ""
+	if idx := strings.IndexAny(expr, ":-?"); idx >= 0 {
+		name, op = expr[:idx], expr[idx:]
+		switch {
+		case strings.HasPrefix(op, ":-"), strings.HasPrefix(op, ":?"):
+			op, arg = op[:2], op[2:]
+		case strings.HasPrefix(op, "-"), strings.HasPrefix(op, "?"):
+			op, arg = op[:1], op[1:]
+		default:
+			return "", fmt.Errorf("invalid variable expression ${%v}", expr)
+		}
+	}
+	if !isValidVariableName(name) {
+		return "", fmt.Errorf("invalid variable name %q", name)
+	}
+	value, ok := lookup(name)
+	switch op {
+	case ":-":
+		if !ok || value == "" {
+			return arg, nil
+		}
+	case "-":
+		if !ok {
+			return arg, nil
+		}
+	case ":?":
+		if !ok || value == "" {
+			return "", requiredVariableError(name, arg)
+		}
+	case "?":
+		if !ok {
+			return "", requiredVariableError(name, arg)
+		}
+	}
+	return value, nil
+}
+
+func requiredVariableError(name, msg string) error {
+	if msg == "" {
+		return fmt.Errorf("required variable %v is not set", name)
+	}
+	return fmt.Errorf("required variable %v is not set: %v", name, msg)
+}
+
+func isValidVariableName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for idx, c := range name {
+		switch {
+		case c == '_', c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z':
+		case c >= '0' && c <= '9' && idx > 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// loadDotEnv reads KEY=VALUE pairs from path. A missing file is not an error.
+func loadDotEnv(path string) (map[string]string, error) {
+	vars := make(map[string]string)
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return vars, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 || !isValidVariableName(strings.TrimSpace(parts[0])) {
+			return nil, fmt.Errorf("%v:%v: malformed line, expected KEY=VALUE", path, lineNo)
+		}
+		value := strings.TrimSpace(parts[1])
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		vars[strings.TrimSpace(parts[0])] = value
+	}
+	return vars, scanner.Err()
+}
@@ -0,0 +1,44 @@
+package lib
+
+import (
+	"testing"
+)
+
+func TestInterpolate(t *testing.T) {
+	vars := map[string]string{"NAME": "redis", "EMPTY": ""}
+	lookup := func(name string) (string, bool) {
+		value, ok := vars[name]
+		return value, ok
+	}
+	cases := []struct {
+		input    string
+		expected string
+		err      string
+	}{
+		{input: "plain", expected: "plain"},
+		{input: "${NAME}", expected: "redis"},
+		{input: "docker://${NAME}:latest", expected: "docker://redis:latest"},
+		{input: "${UNSET}", expected: ""},
+		{input: "${UNSET:-default}", expected: "default"},
+		{input: "${EMPTY:-default}", expected: "default"},
+		{input: "${EMPTY-default}", expected: ""},
+		{input: "${UNSET-default}", expected: "default"},
+		{input: "$${NAME} costs $5", expected: "${NAME} costs $5"},
+		{input: "${UNSET:?set it}", err: "required variable UNSET is not set: set it"},
+		{input: "${EMPTY:?}", err: "required variable EMPTY is not set"},
+		{input: "${EMPTY?}", expected: ""},
+		{input: "${NAME", err: `unterminated variable expression in "${NAME"`},
+		{input: "${1NAME}", err: `invalid variable name "1NAME"`},
+	}
+	for _, c := range cases {
+		result, err := interpolate(c.input, lookup)
+		switch {
+		case c.err != "" && (err == nil || err.Error() != c.err):
+			t.Errorf("%v: expected error %q, got %v", c.input, c.err, err)
+		case c.err == "" && err != nil:
+			t.Errorf("%v: unexpected error %v", c.input, err)
+		case c.err == "" && result != c.expected:
+			t.Errorf("%v: expected %q, got %q", c.input, c.expected, result)
+		}
+	}
+}
@@ -0,0 +1,214 @@
+package lib
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/appc/spec/schema/types"
+	"github.com/ghodss/yaml"
+)
+
+// LockFileName is the name of the lock file written next to the compose file
+const LockFileName = "rkt-compose.lock"
+
+// A LockFile pins the image ids resolved for the apps of a pod
+type LockFile struct {
+	Images []*LockedImage `json:"images"`
+}
+
+// A LockedImage is the resolved image id of a single app
+type LockedImage struct {
+	App   types.ACName `json:"app"`
+	Image string       `json:"image"`
+	ID    types.Hash   `json:"id"`
+}
+
+// ReadLockFile reads a lock file from disk
+func ReadLockFile(path string) (*LockFile, error) {
+	bs, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	lock := &LockFile{}
+	if err := yaml.Unmarshal(bs, lock); err != nil {
+		return nil, fmt.Errorf("%v: %v", path, err)
+	}
+	return lock, nil
+}
+
+// Write replaces the lock file on disk, readers never see a partial file
+func (lock *LockFile) Write(path string) error {
+	bs, err := yaml.Marshal(lock)
+	if err != nil {
+		return err
+	}
+	bs = append([]byte("# This file is generated by rkt-compose, do not edit.\n"), bs...)
+	return WriteFileAtomic(path, bs, 0644)
+}
+
+func (lock *LockFile) entry(app types.ACName) *LockedImage {
+	for _, entry := range lock.Images {
+		if entry.App == app {
+			return entry
+		}
+	}
+	return nil
+}
+
+// LockFilePath returns the path of the lock file belonging to the compose file
+func (composeFile *ComposeFile) LockFilePath() string {
+	dir := "."
+	if len(composeFile.sources) > 0 {
+		dir = filepath.Dir(composeFile.sources[0].path)
+	}
+	return filepath.Join(dir, LockFileName)
+}
+
+// lockedApps returns the apps whose image ids are resolved by name and labels
+func (composeFile *ComposeFile) lockedApps() []*RuntimeApp {
+	apps := []*RuntimeApp{}
+	for _, app := range composeFile.Manifest.Apps {
+		if app.Image.ID.Empty() {
+			apps = append(apps, app)
+		}
+	}
+	return apps
+}
+
+// checkLock returns an error if the lock does not exactly cover the apps
+func (composeFile *ComposeFile) checkLock(lock *LockFile) error {
+	problems := []string{}
+	apps := composeFile.lockedApps()
+	known := map[types.ACName]bool{}
+	for _, app := range apps {
+		known[app.Name] = true
+		entry := lock.entry(app.Name)
+		switch {
+		case entry == nil:
+			problems = append(problems, fmt.Sprintf("app %v is not locked", app.Name))
+		case entry.Image != app.Image.imageURL():
+			problems = append(problems, fmt.Sprintf("app %v uses image %v, but %v is locked", app.Name, app.Image.imageURL(), entry.Image))
+		}
+	}
+	for _, entry := range lock.Images {
+		if !known[entry.App] {
+			problems = append(problems, fmt.Sprintf("app %v is locked but not defined", entry.App))
+		}
+	}
+	if len(problems) > 0 {
+		return newError(ErrLockFile, "lock file is stale:\n  %v", strings.Join(problems, "\n  "))
+	}
+	return nil
+}
+
+func newLockFile(apps []*RuntimeApp) *LockFile {
+	lock := &LockFile{}
+	for _, app := range apps {
+		lock.Images = append(lock.Images, &LockedImage{
+			App:   app.Name,
+			Image: app.Image.imageURL(),
+			ID:    app.Image.ID,
+		})
+	}
+	return lock
+}
+
+// resolveImages fills in the image ids of all apps.
+// If a lock file is configured, pinned ids are reused and newly resolved
+// ones are recorded. Pinned images missing in the store are fetched again,
+// ErrLockFile is returned if they now resolve to another id.
+func (composeFile *ComposeFile) resolveImages(opts PrepareOptions) error {
+	if opts.LockFile == "" {
+		return composeFile.fetchImages(opts.Runner, opts.FetchJobs, "")
+	}
+	lock, err := ReadLockFile(opts.LockFile)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if lock == nil {
+		if opts.Frozen {
+			return newError(ErrLockFile, "lock file %v is missing", opts.LockFile)
+		}
+		lock = &LockFile{}
+	}
+	if opts.Frozen {
+		if err := composeFile.checkLock(lock); err != nil {
+			return err
+		}
+	}
+
+	// unlocked apps keep an empty id to get resolved by fetchImages
+	lockedApps := composeFile.lockedApps()
+	pinned := map[*RuntimeApp]types.Hash{}
+	if !opts.UpdateLock {
+		for _, app := range lockedApps {
+			entry := lock.entry(app.Name)
+			if entry == nil || entry.Image != app.Image.imageURL() {
+				continue
+			}
+			if imageInStore(opts.Runner, entry.ID) {
+				app.Image.ID = entry.ID
+			} else {
+				log.Printf("locked image %v of app %v is missing in the store, fetching it...", entry.ID, app.Name)
+				pinned[app] = entry.ID
+			}
+		}
+	}
+	pullPolicy := ""
+	if opts.UpdateLock {
+		pullPolicy = "update"
+	}
+	if err := composeFile.fetchImages(opts.Runner, opts.FetchJobs, pullPolicy); err != nil {
+		return err
+	}
+	// a locked image fetched again has to be the same, the lock is only
+	// moved on explicitly
+	for app, id := range pinned {
+		if dryRun(opts.Runner) && app.Image.ID.String() == unknownImageID {
+			app.Image.ID = id
+			continue
+		}
+		if app.Image.ID != id {
+			return newError(ErrLockFile, "image %v of app %v resolved to %v, but %v is locked, run lock --update to use it", app.Image.imageURL(), app.Name, app.Image.ID, id)
+		}
+	}
+	if opts.Frozen {
+		return nil
+	}
+
+	newLock := newLockFile(lockedApps)
+	old, _ := yaml.Marshal(lock)
+	updated, err := yaml.Marshal(newLock)
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(old, updated) {
+		return nil
+	}
+	if dryRun(opts.Runner) {
+		log.Printf("dry-run: would write lock file %v", opts.LockFile)
+		return nil
+	}
+	log.Printf("writing lock file %v", opts.LockFile)
+	return newLock.Write(opts.LockFile)
+}
+
+// Lock resolves all image ids and records them in the lock file
+// without generating a pod manifest
+func (composeFile *ComposeFile) Lock(opts PrepareOptions) error {
+	if opts.LockFile == "" {
+		opts.LockFile = composeFile.LockFilePath()
+	}
+	return composeFile.resolveImages(opts)
+}
+
+// imageInStore checks if rkt knows an image with the given id
+func imageInStore(runner Runner, id types.Hash) bool {
+	_, err := runQuery(runner, "rkt", "image", "cat-manifest", id.String())
+	return err == nil
+}
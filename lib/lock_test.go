@@ -0,0 +1,144 @@
+package lib
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/appc/spec/schema/types"
+)
+
+const otherImageID = "sha512-fedcba9876543210fedcba9876543210"
+
+// newImageStore returns a runner which knows the images with the given ids
+// and fetches every image as fetched
+func newImageStore(fetched string, ids ...string) *fakeRunner {
+	return newFakeRunner(func(cmd *Command) error {
+		switch cmd.Args[0] {
+		case "image":
+			for _, id := range ids {
+				if cmd.Args[2] == id {
+					return nil
+				}
+			}
+			return exitStatus(1)
+		case "fetch":
+			fmt.Fprintln(cmd.Stdout, fetched)
+		}
+		return nil
+	})
+}
+
+// writeLockFile writes a lock file with the given entries to a new
+// temporary directory, which is removed by the returned func
+func writeLockFile(t *testing.T, entries ...*LockedImage) (string, func()) {
+	dir, err := ioutil.TempDir("", "rkt-compose-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, LockFileName)
+	if err := (&LockFile{Images: entries}).Write(path); err != nil {
+		t.Fatal(err)
+	}
+	return path, func() { os.RemoveAll(dir) }
+}
+
+func lockedImage(app, image, id string) *LockedImage {
+	hash, _ := types.NewHash(id)
+	return &LockedImage{App: types.ACName(app), Image: image, ID: *hash}
+}
+
+func TestResolveImagesFrozen(t *testing.T) {
+	tests := map[string][]*LockedImage{
+		"app app1 is not locked": {lockedImage("app0", "docker://redis", testImageID)},
+		"app app1 uses image docker://postgres, but docker://mysql is locked": {lockedImage("app0", "docker://redis", testImageID), lockedImage("app1", "docker://mysql", testImageID)},
+		"app app2 is locked but not defined": {
+			lockedImage("app0", "docker://redis", testImageID), lockedImage("app1", "docker://postgres", testImageID), lockedImage("app2", "docker://etcd", testImageID),
+		},
+	}
+	for expected, entries := range tests {
+		path, cleanup := writeLockFile(t, entries...)
+		runner := newImageStore(testImageID, testImageID)
+		composeFile := testComposeFile("docker://redis", "docker://postgres")
+		err := composeFile.resolveImages(PrepareOptions{Runner: runner, LockFile: path, Frozen: true})
+		cleanup()
+		if !errors.Is(err, ErrLockFile) || !strings.Contains(err.Error(), expected) {
+			t.Errorf("expected %q, got %v", expected, err)
+		}
+		if calls := runner.Calls(); len(calls) != 0 {
+			t.Errorf("expected no calls for a stale lock, got %q", calls)
+		}
+	}
+
+	runner := newImageStore(testImageID)
+	err := testComposeFile("docker://redis").resolveImages(PrepareOptions{Runner: runner, LockFile: "/nonexistent/" + LockFileName, Frozen: true})
+	if !errors.Is(err, ErrLockFile) || err.Error() != "lock file /nonexistent/rkt-compose.lock is missing" {
+		t.Errorf("expected the missing lock file to be reported, got %v", err)
+	}
+}
+
+func TestResolveImagesUsesLockedIDs(t *testing.T) {
+	path, cleanup := writeLockFile(t, lockedImage("app0", "docker://redis", testImageID))
+	defer cleanup()
+	before, _ := ioutil.ReadFile(path)
+	runner := newImageStore(otherImageID, testImageID)
+	composeFile := testComposeFile("docker://redis")
+	if err := composeFile.resolveImages(PrepareOptions{Runner: runner, LockFile: path}); err != nil {
+		t.Fatal(err)
+	}
+	if id := composeFile.Manifest.Apps[0].Image.ID.String(); id != testImageID {
+		t.Errorf("expected the locked id, got %v", id)
+	}
+	if calls := runner.Calls(); len(calls) != 1 || calls[0] != "rkt image cat-manifest "+testImageID {
+		t.Errorf("expected the image to be taken from the store, got %q", calls)
+	}
+	if after, _ := ioutil.ReadFile(path); string(after) != string(before) {
+		t.Errorf("expected the lock file to be unchanged, got %s", after)
+	}
+}
+
+func TestResolveImagesDrift(t *testing.T) {
+	for _, frozen := range []bool{false, true} {
+		path, cleanup := writeLockFile(t, lockedImage("app0", "docker://redis", testImageID))
+		before, _ := ioutil.ReadFile(path)
+
+		// the locked image is gone and the tag now points to another image
+		runner := newImageStore(otherImageID)
+		composeFile := testComposeFile("docker://redis")
+		err := composeFile.resolveImages(PrepareOptions{Runner: runner, LockFile: path, Frozen: frozen})
+		expected := fmt.Sprintf("image docker://redis of app app0 resolved to %v, but %v is locked, run lock --update to use it", otherImageID, testImageID)
+		if !errors.Is(err, ErrLockFile) || err.Error() != expected {
+			t.Errorf("frozen=%v: expected %q, got %v", frozen, expected, err)
+		}
+		if after, _ := ioutil.ReadFile(path); string(after) != string(before) {
+			t.Errorf("frozen=%v: expected the lock file to be unchanged, got %s", frozen, after)
+		}
+
+		// fetching the locked image again is fine
+		runner = newImageStore(testImageID)
+		composeFile = testComposeFile("docker://redis")
+		if err := composeFile.resolveImages(PrepareOptions{Runner: runner, LockFile: path, Frozen: frozen}); err != nil {
+			t.Errorf("frozen=%v: expected the refetched image to match, got %v", frozen, err)
+		}
+		cleanup()
+	}
+
+	// lock --update moves the lock on
+	path, cleanup := writeLockFile(t, lockedImage("app0", "docker://redis", testImageID))
+	defer cleanup()
+	runner := newImageStore(otherImageID)
+	if err := testComposeFile("docker://redis").resolveImages(PrepareOptions{Runner: runner, LockFile: path, UpdateLock: true}); err != nil {
+		t.Fatal(err)
+	}
+	lock, err := ReadLockFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id := lock.entry("app0").ID.String(); id != otherImageID {
+		t.Errorf("expected the updated id to be locked, got %v", id)
+	}
+}
@@ -1,21 +1,218 @@
 package lib
 
 import (
-	"errors"
-	"io/ioutil"
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
 	"os"
-	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 )
 
-func Logs(args []string) error {
-	bs, err := ioutil.ReadFile(".pod-uuid")
+// LogEntry is a single line logged by an app of the pod
+type LogEntry struct {
+	Time    time.Time `json:"time"`
+	App     string    `json:"app"`
+	Message string    `json:"message"`
+}
+
+// LogOptions select the log entries to read
+type LogOptions struct {
+	// Apps to read the logs of, all if empty
+	Apps []string
+	// Follow keeps reading new entries until the reader is stopped
+	Follow bool
+	// Since is either a duration like 10m or a time understood by journalctl
+	Since string
+	// Tail limits the output to the last Tail entries, 0 means all
+	Tail int
+}
+
+// LogReader reads the log entries of a pod and passes them to fn in order.
+// Reading stops at the first error returned by fn.
+type LogReader interface {
+	ReadLogs(opts LogOptions, fn func(*LogEntry) error) error
+}
+
+// JournalReader reads the logs of a pod from the journal of its machine
+type JournalReader struct {
+	UUID string
+	// ExtraArgs are passed to journalctl unchanged
+	ExtraArgs []string
+	// Runner runs journalctl
+	Runner Runner
+}
+
+// NewJournalReader returns a reader for the pod whose uuid is saved in uuidFile
+func NewJournalReader(runner Runner, uuidFile string) (*JournalReader, error) {
+	uuid, err := readPodUUID(uuidFile)
 	if err != nil {
-		return errors.New("can not open .pod-uuid file: " + err.Error())
-	}
-	args = append([]string{"-M", "rkt-" + string(bs)}, args...)
-	cmd := exec.Command("journalctl", args...)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	cmd.Stdin = os.Stdin
-	return cmd.Run()
+		return nil, err
+	}
+	return &JournalReader{UUID: uuid, Runner: runner}, nil
+}
+
+// ReadLogs implements LogReader using the json output of journalctl
+func (reader *JournalReader) ReadLogs(opts LogOptions, fn func(*LogEntry) error) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	pipeReader, pipeWriter := io.Pipe()
+	cmd := &Command{
+		Name:   "journalctl",
+		Args:   reader.args(opts, time.Now()),
+		Stdout: pipeWriter,
+		Stderr: os.Stderr,
+		Query:  true,
+	}
+	runErr := make(chan error, 1)
+	go func() {
+		err := reader.Runner.Run(ctx, cmd)
+		pipeWriter.CloseWithError(err)
+		runErr <- err
+	}()
+	if err := readJournalEntries(pipeReader, fn); err != nil {
+		// stop journalctl, which may be following the journal
+		cancel()
+		pipeReader.Close()
+		<-runErr
+		return err
+	}
+	return <-runErr
+}
+
+func (reader *JournalReader) args(opts LogOptions, now time.Time) []string {
+	args := []string{"-M", "rkt-" + reader.UUID, "--output=json", "--no-pager"}
+	if opts.Follow {
+		args = append(args, "--follow")
+	}
+	if opts.Tail > 0 {
+		args = append(args, "--lines="+strconv.Itoa(opts.Tail))
+	}
+	if opts.Since != "" {
+		since := opts.Since
+		if duration, err := time.ParseDuration(since); err == nil {
+			since = now.Add(-duration).Format("2006-01-02 15:04:05")
+		}
+		args = append(args, "--since="+since)
+	}
+	args = append(args, reader.ExtraArgs...)
+	// matches on the same field are combined with OR by journalctl
+	for _, app := range opts.Apps {
+		args = append(args, "SYSLOG_IDENTIFIER="+app)
+	}
+	return args
+}
+
+// journalEntry contains the fields of a journal export used here.
+// MESSAGE is a string, or an array of bytes if it is not valid utf-8.
+type journalEntry struct {
+	Timestamp  string          `json:"__REALTIME_TIMESTAMP"`
+	Identifier string          `json:"SYSLOG_IDENTIFIER"`
+	Unit       string          `json:"_SYSTEMD_UNIT"`
+	Message    json.RawMessage `json:"MESSAGE"`
+}
+
+// readJournalEntries decodes the output of journalctl --output=json
+func readJournalEntries(input io.Reader, fn func(*LogEntry) error) error {
+	decoder := json.NewDecoder(bufio.NewReader(input))
+	for {
+		raw := &journalEntry{}
+		if err := decoder.Decode(raw); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("can not parse journal entry: %v", err)
+		}
+		entry := &LogEntry{App: raw.Identifier}
+		if entry.App == "" {
+			entry.App = strings.TrimSuffix(raw.Unit, ".service")
+		}
+		if usec, err := strconv.ParseInt(raw.Timestamp, 10, 64); err == nil {
+			entry.Time = time.Unix(0, usec*int64(time.Microsecond))
+		}
+		var message string
+		var bs []byte
+		if err := json.Unmarshal(raw.Message, &message); err == nil {
+			entry.Message = message
+		} else if err := json.Unmarshal(raw.Message, &bs); err == nil {
+			entry.Message = string(bs)
+		}
+		if err := fn(entry); err != nil {
+			return err
+		}
+	}
+}
+
+// logColors are the ansi colors used for app prefixes, in order
+var logColors = []string{"36", "33", "32", "35", "34", "31", "36;1", "33;1", "32;1", "35;1", "34;1", "31;1"}
+
+// LogPrinter writes log entries docker-compose style: prefixed with the
+// app name, which is colored per app. In json mode every entry is written
+// as a json object on its own line.
+type LogPrinter struct {
+	Output     io.Writer
+	JSON       bool
+	Color      bool
+	Timestamps bool
+
+	mutex  sync.Mutex
+	width  int
+	colors map[string]string
+}
+
+// NewLogPrinter returns a printer which aligns the prefixes of apps
+func NewLogPrinter(output io.Writer, apps []string) *LogPrinter {
+	printer := &LogPrinter{Output: output, colors: make(map[string]string)}
+	for _, app := range apps {
+		printer.color(app)
+	}
+	return printer
+}
+
+// color returns the color of app, assigning the next free one if needed
+func (printer *LogPrinter) color(app string) string {
+	if color, ok := printer.colors[app]; ok {
+		return color
+	}
+	color := logColors[len(printer.colors)%len(logColors)]
+	printer.colors[app] = color
+	if len(app) > printer.width {
+		printer.width = len(app)
+	}
+	return color
+}
+
+// Print writes a single entry, it is safe for concurrent use
+func (printer *LogPrinter) Print(entry *LogEntry) error {
+	printer.mutex.Lock()
+	defer printer.mutex.Unlock()
+	if printer.colors == nil {
+		printer.colors = make(map[string]string)
+	}
+	if printer.JSON {
+		bs, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(printer.Output, "%s\n", bs)
+		return err
+	}
+	color := printer.color(entry.App)
+	prefix := fmt.Sprintf("%-*s |", printer.width, entry.App)
+	if printer.Color {
+		prefix = "\x1b[" + color + "m" + prefix + "\x1b[0m"
+	}
+	if printer.Timestamps {
+		prefix += " " + entry.Time.Format(time.RFC3339Nano)
+	}
+	_, err := fmt.Fprintf(printer.Output, "%v %v\n", prefix, strings.TrimRight(entry.Message, "\n"))
+	return err
+}
+
+// Logs reads the logs selected by opts from reader and prints them
+func Logs(reader LogReader, opts LogOptions, printer *LogPrinter) error {
+	return reader.ReadLogs(opts, printer.Print)
 }
@@ -0,0 +1,102 @@
+package lib
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testJournal = `{"__REALTIME_TIMESTAMP":"1500000000000000","SYSLOG_IDENTIFIER":"redis","MESSAGE":"ready"}
+{"__REALTIME_TIMESTAMP":"1500000001000000","_SYSTEMD_UNIT":"postgresql.service","MESSAGE":[104,105]}
+`
+
+func TestJournalReader(t *testing.T) {
+	runner := &fakeRunner{respond: func(cmd *Command) error {
+		fmt.Fprint(cmd.Stdout, testJournal)
+		return nil
+	}}
+	reader := &JournalReader{UUID: "1234", Runner: runner}
+	entries := []*LogEntry{}
+	err := reader.ReadLogs(LogOptions{Apps: []string{"redis", "postgresql"}, Tail: 10}, func(entry *LogEntry) error {
+		entries = append(entries, entry)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []*LogEntry{
+		{Time: time.Unix(1500000000, 0), App: "redis", Message: "ready"},
+		{Time: time.Unix(1500000001, 0), App: "postgresql", Message: "hi"},
+	}
+	if !reflect.DeepEqual(entries, expected) {
+		t.Errorf("expected %+v, got %+v", expected, entries)
+	}
+	call := "journalctl -M rkt-1234 --output=json --no-pager --lines=10 SYSLOG_IDENTIFIER=redis SYSLOG_IDENTIFIER=postgresql"
+	if calls := runner.Calls(); len(calls) != 1 || calls[0] != call {
+		t.Errorf("expected call %q, got %q", call, calls)
+	}
+}
+
+func TestJournalReaderStopsOnError(t *testing.T) {
+	runner := &fakeRunner{respond: func(cmd *Command) error {
+		for {
+			if _, err := fmt.Fprint(cmd.Stdout, testJournal); err != nil {
+				return err
+			}
+		}
+	}}
+	reader := &JournalReader{UUID: "1234", Runner: runner}
+	stop := errors.New("stop")
+	err := reader.ReadLogs(LogOptions{Follow: true}, func(entry *LogEntry) error {
+		return stop
+	})
+	if err != stop {
+		t.Errorf("expected the error of the callback, got %v", err)
+	}
+}
+
+func TestJournalReaderSince(t *testing.T) {
+	now := time.Date(2017, 6, 1, 12, 0, 0, 0, time.Local)
+	reader := &JournalReader{UUID: "1234"}
+	for since, expected := range map[string]string{
+		"10m":        "--since=2017-06-01 11:50:00",
+		"yesterday":  "--since=yesterday",
+		"2017-05-01": "--since=2017-05-01",
+	} {
+		args := reader.args(LogOptions{Since: since}, now)
+		if args[len(args)-1] != expected {
+			t.Errorf("since %v: expected %v, got %q", since, expected, args)
+		}
+	}
+}
+
+func TestLogPrinter(t *testing.T) {
+	output := &bytes.Buffer{}
+	printer := NewLogPrinter(output, []string{"redis", "postgresql"})
+	printer.Print(&LogEntry{App: "redis", Message: "ready\n"})
+	printer.Print(&LogEntry{App: "postgresql", Message: "hi"})
+	expected := "redis      | ready\npostgresql | hi\n"
+	if output.String() != expected {
+		t.Errorf("expected %q, got %q", expected, output.String())
+	}
+
+	output.Reset()
+	printer.JSON = true
+	printer.Print(&LogEntry{Time: time.Unix(0, 0).UTC(), App: "redis", Message: "ready"})
+	expected = `{"time":"1970-01-01T00:00:00Z","app":"redis","message":"ready"}` + "\n"
+	if output.String() != expected {
+		t.Errorf("expected %q, got %q", expected, output.String())
+	}
+
+	output.Reset()
+	printer.JSON = false
+	printer.Color = true
+	printer.Print(&LogEntry{App: "postgresql", Message: "hi"})
+	if !strings.HasPrefix(output.String(), "\x1b[33mpostgresql |\x1b[0m") {
+		t.Errorf("expected the second color for the second app, got %q", output.String())
+	}
+}
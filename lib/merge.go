@@ -0,0 +1,250 @@
+package lib
+
+import (
+	"github.com/appc/spec/schema"
+	"github.com/appc/spec/schema/types"
+)
+
+// Merge deep-merges other into the compose file.
+// Scalar values which are set in other win, apps are matched by name,
+// environment entries by name, volumes by name and plain lists like extra
+// are appended.
+func (composeFile *ComposeFile) Merge(other *ComposeFile) {
+	if other.Name != "" {
+		composeFile.Name = other.Name
+	}
+	if other.CPU != "" {
+		composeFile.CPU = other.CPU
+	}
+	if other.Memory != "" {
+		composeFile.Memory = other.Memory
+	}
+	for _, network := range other.Networks {
+		if existing := composeFile.network(network.Name); existing != nil {
+			existing.merge(network)
+		} else {
+			composeFile.Networks = append(composeFile.Networks, network)
+		}
+	}
+	if other.Hostname != "" {
+		composeFile.Hostname = other.Hostname
+	}
+	composeFile.DNS = appendUnique(composeFile.DNS, other.DNS...)
+	composeFile.DNSSearch = appendUnique(composeFile.DNSSearch, other.DNSSearch...)
+	composeFile.DNSOptions = appendUnique(composeFile.DNSOptions, other.DNSOptions...)
+	if other.DNSDomain != "" {
+		composeFile.DNSDomain = other.DNSDomain
+	}
+	composeFile.HostsEntries = appendUnique(composeFile.HostsEntries, other.HostsEntries...)
+	if other.Stage1 != "" {
+		composeFile.Stage1 = other.Stage1
+	}
+	composeFile.Extra = append(composeFile.Extra, other.Extra...)
+	if other.Restart != nil {
+		if composeFile.Restart == nil {
+			composeFile.Restart = &RestartPolicy{}
+		}
+		composeFile.Restart.merge(other.Restart)
+	}
+	for _, secret := range other.Secrets {
+		if existing := composeFile.secret(secret.Name); existing != nil {
+			existing.merge(secret)
+		} else {
+			composeFile.Secrets = append(composeFile.Secrets, secret)
+		}
+	}
+	composeFile.Manifest.merge(&other.Manifest)
+	composeFile.sources = append(composeFile.sources, other.sources...)
+}
+
+func (manifest *PodManifest) merge(other *PodManifest) {
+	for _, app := range other.Apps {
+		if existing := manifest.app(app.Name); existing != nil {
+			existing.merge(app)
+		} else {
+			manifest.Apps = append(manifest.Apps, app)
+		}
+	}
+	for _, vol := range other.Volumes {
+		if existing := manifest.volume(vol.Name); existing != nil {
+			existing.merge(vol)
+		} else {
+			manifest.Volumes = append(manifest.Volumes, vol)
+		}
+	}
+	manifest.Isolators = mergeIsolators(manifest.Isolators, other.Isolators)
+	manifest.Annotations = mergeAnnotations(manifest.Annotations, other.Annotations)
+	manifest.Ports = mergeByKey(manifest.Ports, other.Ports, func(port types.ExposedPort) types.ACName { return port.Name })
+	manifest.UserAnnotations = types.UserAnnotations(mergeMaps(manifest.UserAnnotations, other.UserAnnotations))
+	manifest.UserLabels = types.UserLabels(mergeMaps(manifest.UserLabels, other.UserLabels))
+}
+
+func (manifest *PodManifest) app(name types.ACName) *RuntimeApp {
+	for _, app := range manifest.Apps {
+		if app.Name == name {
+			return app
+		}
+	}
+	return nil
+}
+
+func (manifest *PodManifest) volume(name types.ACName) *Volume {
+	for _, vol := range manifest.Volumes {
+		if vol.Name == name {
+			return vol
+		}
+	}
+	return nil
+}
+
+func (app *RuntimeApp) merge(other *RuntimeApp) {
+	if other.Image.Name != "" {
+		app.Image.Name = other.Image.Name
+	}
+	if !other.Image.ID.Empty() {
+		app.Image.ID = other.Image.ID
+	}
+	app.Image.Labels = mergeByKey(app.Image.Labels, other.Image.Labels, func(label types.Label) types.ACIdentifier { return label.Name })
+	if other.App != nil {
+		if app.App == nil {
+			app.App = other.App
+		} else {
+			app.App.merge(other.App)
+		}
+	}
+	if other.ReadOnlyRootFS != nil {
+		app.ReadOnlyRootFS = other.ReadOnlyRootFS
+	}
+	app.Mounts = mergeByKey(app.Mounts, other.Mounts, func(mount schema.Mount) types.ACName { return mount.Volume })
+	app.Annotations = mergeAnnotations(app.Annotations, other.Annotations)
+	app.DependsOn = appendUnique(app.DependsOn, other.DependsOn...)
+	app.Publish = appendUnique(app.Publish, other.Publish...)
+	if other.Readiness != nil {
+		if app.Readiness == nil {
+			app.Readiness = &Readiness{}
+		}
+		app.Readiness.merge(other.Readiness)
+	}
+	if other.Healthcheck != nil {
+		if app.Healthcheck == nil {
+			app.Healthcheck = &Healthcheck{}
+		}
+		app.Healthcheck.merge(other.Healthcheck)
+	}
+	app.Secrets = mergeByKey(app.Secrets, other.Secrets, func(secret *AppSecret) AppSecret { return *secret })
+}
+
+func (app *App) merge(other *App) {
+	if len(other.Exec) > 0 {
+		app.Exec = other.Exec
+	}
+	app.EventHandlers = mergeByKey(app.EventHandlers, other.EventHandlers, func(handler types.EventHandler) string { return handler.Name })
+	if other.User != "" {
+		app.User = other.User
+	}
+	if other.Group != "" {
+		app.Group = other.Group
+	}
+	if len(other.SupplementaryGIDs) > 0 {
+		app.SupplementaryGIDs = other.SupplementaryGIDs
+	}
+	if other.WorkingDirectory != "" {
+		app.WorkingDirectory = other.WorkingDirectory
+	}
+	for _, env := range other.Environment {
+		app.Environment.Set(env.Name, env.Value)
+	}
+	app.MountPoints = mergeByKey(app.MountPoints, other.MountPoints, func(mountPoint types.MountPoint) types.ACName { return mountPoint.Name })
+	app.Ports = mergeByKey(app.Ports, other.Ports, func(port types.Port) types.ACName { return port.Name })
+	app.Isolators = mergeIsolators(app.Isolators, other.Isolators)
+	app.UserAnnotations = types.UserAnnotations(mergeMaps(app.UserAnnotations, other.UserAnnotations))
+	app.UserLabels = types.UserLabels(mergeMaps(app.UserLabels, other.UserLabels))
+	if other.CPU != "" {
+		app.CPU = other.CPU
+	}
+	if other.CPURequest != "" {
+		app.CPURequest = other.CPURequest
+	}
+	if other.Memory != "" {
+		app.Memory = other.Memory
+	}
+	if other.MemoryRequest != "" {
+		app.MemoryRequest = other.MemoryRequest
+	}
+}
+
+func (vol *Volume) merge(other *Volume) {
+	if other.Kind != "" {
+		vol.Kind = other.Kind
+	}
+	if other.Source != "" {
+		vol.Source = other.Source
+	}
+	if other.ReadOnly != nil {
+		vol.ReadOnly = other.ReadOnly
+	}
+	if other.Recursive != nil {
+		vol.Recursive = other.Recursive
+	}
+	if other.Mode != nil {
+		vol.Mode = other.Mode
+	}
+	if other.UID != nil {
+		vol.UID = other.UID
+	}
+	if other.GID != nil {
+		vol.GID = other.GID
+	}
+}
+
+// mergeByKey merges the entries of other into base: an entry replaces the
+// entry of base with the same key, entries with new keys are appended
+func mergeByKey[T any, K comparable](base, other []T, key func(T) K) []T {
+	for _, entry := range other {
+		found := false
+		for idx := range base {
+			if key(base[idx]) == key(entry) {
+				base[idx] = entry
+				found = true
+				break
+			}
+		}
+		if !found {
+			base = append(base, entry)
+		}
+	}
+	return base
+}
+
+func mergeIsolators(base, other []types.Isolator) []types.Isolator {
+	return mergeByKey(base, other, func(iso types.Isolator) types.ACIdentifier { return iso.Name })
+}
+
+func mergeAnnotations(base, other types.Annotations) types.Annotations {
+	for _, annotation := range other {
+		base.Set(annotation.Name, annotation.Value)
+	}
+	return base
+}
+
+func mergeMaps(base, other map[string]string) map[string]string {
+	if len(other) == 0 {
+		return base
+	}
+	if base == nil {
+		base = make(map[string]string)
+	}
+	for key, value := range other {
+		base[key] = value
+	}
+	return base
+}
+
+func appendUnique(base []string, values ...string) []string {
+	return mergeByKey(base, values, func(value string) string { return value })
+}
+
+// boolValue returns the value of an optional flag, which is false if unset
+func boolValue(flag *bool) bool {
+	return flag != nil && *flag
+}
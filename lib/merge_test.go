@@ -0,0 +1,160 @@
+package lib
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/ghodss/yaml"
+)
+
+func TestMerge(t *testing.T) {
+	tests := []struct {
+		name                  string
+		base, other, expected string
+	}{
+		{
+			name:     "scalars set in other win",
+			base:     "name: base\ncpu: 500m\nmemory: 1G",
+			other:    "cpu: 1",
+			expected: "name: base\ncpu: 1\nmemory: 1G",
+		},
+		{
+			name:     "empty other keeps everything",
+			base:     "name: base\nextra: [--debug]\nmanifest: {apps: [{name: web, image: {name: web}}]}",
+			other:    "{}",
+			expected: "name: base\nextra: [--debug]\nmanifest: {apps: [{name: web, image: {name: web}}]}",
+		},
+		{
+			name:     "extra is appended",
+			base:     "extra: [--debug, --insecure-options=image]",
+			other:    "extra: [--debug]",
+			expected: "extra: [--debug, --insecure-options=image, --debug]",
+		},
+		{
+			name:     "networks are appended once",
+			base:     "networks: [default, backend]",
+			other:    "networks: [backend, monitoring]",
+			expected: "networks: [default, backend, monitoring]",
+		},
+		{
+			name: "apps are merged by name",
+			base: `
+manifest:
+  apps:
+    - name: web
+      image: {name: web, labels: [{name: version, value: "1"}, {name: os, value: linux}]}
+      app:
+        exec: [web, --port=80]
+        user: www
+        environment: [{name: A, value: "1"}, {name: B, value: "2"}]
+        mountPoints: [{name: data, path: /data}]
+        ports: [{name: http, protocol: tcp, port: 80}]
+    - name: db
+      image: {name: db}`,
+			other: `
+manifest:
+  apps:
+    - name: web
+      image: {labels: [{name: version, value: "2"}]}
+      app:
+        exec: [web, --port=8080]
+        environment: [{name: B, value: "3"}, {name: C, value: "4"}]
+        mountPoints: [{name: data, path: /srv, readOnly: true}]
+        ports: [{name: http, protocol: tcp, port: 8080}, {name: https, protocol: tcp, port: 8443}]
+    - name: cache
+      image: {name: cache}`,
+			expected: `
+manifest:
+  apps:
+    - name: web
+      image: {name: web, labels: [{name: version, value: "2"}, {name: os, value: linux}]}
+      app:
+        exec: [web, --port=8080]
+        user: www
+        environment: [{name: A, value: "1"}, {name: B, value: "3"}, {name: C, value: "4"}]
+        mountPoints: [{name: data, path: /srv, readOnly: true}]
+        ports: [{name: http, protocol: tcp, port: 8080}, {name: https, protocol: tcp, port: 8443}]
+    - name: db
+      image: {name: db}
+    - name: cache
+      image: {name: cache}`,
+		},
+		{
+			name: "volumes and mounts are merged by name",
+			base: `
+manifest:
+  apps:
+    - name: web
+      image: {name: web}
+      mounts: [{volume: data, path: /data}]
+  volumes:
+    - {name: data, kind: host, source: ./data, readOnly: true}`,
+			other: `
+manifest:
+  apps:
+    - name: web
+      mounts: [{volume: data, path: /srv}, {volume: logs, path: /logs}]
+  volumes:
+    - {name: data, source: /srv/data}
+    - {name: logs, kind: empty}`,
+			expected: `
+manifest:
+  apps:
+    - name: web
+      image: {name: web}
+      mounts: [{volume: data, path: /srv}, {volume: logs, path: /logs}]
+  volumes:
+    - {name: data, kind: host, source: /srv/data, readOnly: true}
+    - {name: logs, kind: empty}`,
+		},
+		{
+			name: "flags can be reset by an override",
+			base: `
+networks: [{name: backend, defaultRoute: true}]
+manifest:
+  apps:
+    - name: web
+      image: {name: web}
+      readOnlyRootFS: true
+      healthcheck: {test: [check], restart: true}`,
+			other: `
+networks: [{name: backend, defaultRoute: false}]
+manifest:
+  apps:
+    - name: web
+      readOnlyRootFS: false
+      healthcheck: {restart: false}`,
+			expected: `
+networks: [{name: backend, defaultRoute: false}]
+manifest:
+  apps:
+    - name: web
+      image: {name: web}
+      readOnlyRootFS: false
+      healthcheck: {test: [check], restart: false}`,
+		},
+		{
+			name:     "pod ports and annotations are merged by name",
+			base:     "manifest: {ports: [{name: http, hostPort: 80}], annotations: [{name: a, value: \"1\"}]}",
+			other:    "manifest: {ports: [{name: http, hostPort: 8080}, {name: https, hostPort: 8443}], annotations: [{name: a, value: \"2\"}, {name: b, value: \"3\"}]}",
+			expected: "manifest: {ports: [{name: http, hostPort: 8080}, {name: https, hostPort: 8443}], annotations: [{name: a, value: \"2\"}, {name: b, value: \"3\"}]}",
+		},
+	}
+	for _, test := range tests {
+		base, other, expected := &ComposeFile{}, &ComposeFile{}, &ComposeFile{}
+		for _, part := range []struct {
+			composeFile *ComposeFile
+			yaml        string
+		}{{base, test.base}, {other, test.other}, {expected, test.expected}} {
+			if err := yaml.Unmarshal([]byte(part.yaml), part.composeFile); err != nil {
+				t.Fatalf("%v: %v", test.name, err)
+			}
+		}
+		base.Merge(other)
+		merged, _ := json.Marshal(base)
+		want, _ := json.Marshal(expected)
+		if string(merged) != string(want) {
+			t.Errorf("%v:\nexpected %s\ngot      %s", test.name, want, merged)
+		}
+	}
+}
@@ -0,0 +1,375 @@
+package lib
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/appc/spec/schema/types"
+)
+
+// NetworkConfigDir is the directory rkt reads CNI network configs from
+const NetworkConfigDir = "/etc/rkt/net.d"
+
+// builtinNetworks are provided by rkt itself, host and none are modes
+// rather than networks and can not be combined with others
+var builtinNetworks = map[string]bool{"default": true, "default-restricted": true, "host": true, "none": true}
+
+// A Network attaches the pod to a CNI network.
+// It can be given as a plain network name.
+type Network struct {
+	Name string `json:"name" yaml:"name,omitempty"`
+	// IP requests a static address from the IPAM plugin of the network
+	IP string `json:"ip,omitempty" yaml:"ip,omitempty"`
+	// Args are passed to the CNI plugins as additional CNI_ARGS
+	Args map[string]string `json:"args,omitempty" yaml:"args,omitempty"`
+	// DefaultRoute routes all traffic of the pod through this network. The
+	// route is part of the network config written by `network create`,
+	// pods refuse to start if an existing config lacks it. The default
+	// network always provides the default route.
+	DefaultRoute *bool `json:"defaultRoute,omitempty" yaml:"defaultRoute,omitempty"`
+}
+
+// UnmarshalJSON accepts the network name as shorthand
+func (network *Network) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err == nil {
+		*network = Network{Name: name}
+		return nil
+	}
+	type plainNetwork Network
+	return json.Unmarshal(data, (*plainNetwork)(network))
+}
+
+// MarshalJSON uses the shorthand if only the name is set
+func (network Network) MarshalJSON() ([]byte, error) {
+	if network.IP == "" && len(network.Args) == 0 && network.DefaultRoute == nil {
+		return json.Marshal(network.Name)
+	}
+	type plainNetwork Network
+	return json.Marshal(plainNetwork(network))
+}
+
+func (network *Network) merge(other *Network) {
+	if other.IP != "" {
+		network.IP = other.IP
+	}
+	network.Args = mergeMaps(network.Args, other.Args)
+	if other.DefaultRoute != nil {
+		network.DefaultRoute = other.DefaultRoute
+	}
+}
+
+// String renders the network as argument of rkt run --net,
+// e.g. backend:IP=10.1.2.3;K8S_POD_NAME=web
+func (network *Network) String() string {
+	args := []string{}
+	if network.IP != "" {
+		args = append(args, "IP="+network.IP)
+	}
+	keys := make([]string, 0, len(network.Args))
+	for key := range network.Args {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		args = append(args, key+"="+network.Args[key])
+	}
+	if len(args) == 0 {
+		return network.Name
+	}
+	return network.Name + ":" + strings.Join(args, ";")
+}
+
+// isMode reports whether the network is one of the modes host and none
+func (network *Network) isMode() bool {
+	return network.Name == "host" || network.Name == "none"
+}
+
+// netArg renders the networks as argument of rkt run
+func netArg(networks []*Network) string {
+	names := make([]string, len(networks))
+	for idx, network := range networks {
+		names[idx] = network.String()
+	}
+	return "--net=" + strings.Join(names, ",")
+}
+
+func (composeFile *ComposeFile) network(name string) *Network {
+	for _, network := range composeFile.Networks {
+		if network.Name == name {
+			return network
+		}
+	}
+	return nil
+}
+
+// checkNetworks reports invalid network entries
+func (composeFile *ComposeFile) checkNetworks(report func(path, format string, args ...interface{})) {
+	var defaultRoute *Network
+	for _, network := range composeFile.Networks {
+		path := fmt.Sprintf("networks[%v]", network.Name)
+		if _, err := types.NewACName(network.Name); err != nil {
+			report(path, "invalid network name %q: %v", network.Name, err)
+			continue
+		}
+		if network.isMode() {
+			if len(composeFile.Networks) > 1 {
+				report(path, "network mode %v can not be combined with other networks", network.Name)
+			}
+			if network.IP != "" || len(network.Args) > 0 || boolValue(network.DefaultRoute) {
+				report(path, "network mode %v does not take ip, args or defaultRoute", network.Name)
+			}
+			continue
+		}
+		if network.IP != "" && net.ParseIP(network.IP) == nil {
+			report(path+".ip", "invalid ip %q", network.IP)
+		}
+		for key, value := range network.Args {
+			switch {
+			case key == "" || strings.ContainsAny(key, "=;,:"):
+				report(path+".args", "invalid arg name %q", key)
+			case strings.ToUpper(key) == "IP":
+				report(path+".args", "use ip instead of arg %v", key)
+			case strings.ContainsAny(value, ";,"):
+				report(path+".args."+key, "value %q must not contain ; or ,", value)
+			}
+		}
+		if boolValue(network.DefaultRoute) {
+			switch {
+			case network.Name == "default" || network.Name == "default-restricted":
+				report(path+".defaultRoute", "the routes of network %v can not be changed", network.Name)
+			case defaultRoute != nil:
+				report(path+".defaultRoute", "network %v already provides the default route", defaultRoute.Name)
+			case composeFile.network("default") != nil:
+				report(path+".defaultRoute", "network default already provides the default route")
+			default:
+				defaultRoute = network
+			}
+		}
+	}
+}
+
+// cniConfig is the subset of a CNI network config which is inspected
+type cniConfig struct {
+	Name   string `json:"name"`
+	Bridge string `json:"bridge"`
+	IPAM   struct {
+		Subnet string `json:"subnet"`
+		Routes []struct {
+			Dst string `json:"dst"`
+		} `json:"routes"`
+	} `json:"ipam"`
+}
+
+// hasDefaultRoute reports whether the network routes all traffic
+func (config *cniConfig) hasDefaultRoute() bool {
+	for _, route := range config.IPAM.Routes {
+		if route.Dst == "0.0.0.0/0" {
+			return true
+		}
+	}
+	return false
+}
+
+// readNetworkConfigs reads the CNI configs found in dir by network name
+func readNetworkConfigs(dir string) (map[string]*cniConfig, error) {
+	configs := map[string]*cniConfig{}
+	paths, err := filepath.Glob(filepath.Join(dir, "*.conf"))
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range paths {
+		bs, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		config := &cniConfig{}
+		if err := json.Unmarshal(bs, config); err != nil {
+			return nil, fmt.Errorf("can not parse network config %v: %v", path, err)
+		}
+		configs[config.Name] = config
+	}
+	return configs, nil
+}
+
+// MissingNetworks returns the networks which are neither built into rkt nor
+// configured in dir
+func MissingNetworks(networks []*Network, dir string) ([]*Network, error) {
+	configs, err := readNetworkConfigs(dir)
+	if err != nil {
+		return nil, err
+	}
+	missing := []*Network{}
+	for _, network := range networks {
+		if !builtinNetworks[network.Name] && configs[network.Name] == nil {
+			missing = append(missing, network)
+		}
+	}
+	return missing, nil
+}
+
+// CheckDefaultRoutes makes sure that the networks configured in dir provide
+// the default route if they are asked to. Networks which are not configured
+// yet are left to `network create`.
+func CheckDefaultRoutes(networks []*Network, dir string) error {
+	configs, err := readNetworkConfigs(dir)
+	if err != nil {
+		return err
+	}
+	for _, network := range networks {
+		config := configs[network.Name]
+		if boolValue(network.DefaultRoute) && config != nil && !config.hasDefaultRoute() {
+			return fmt.Errorf("network %v should provide the default route, but its config in %v has no route to 0.0.0.0/0", network.Name, dir)
+		}
+	}
+	return nil
+}
+
+// CreateNetwork writes a CNI config for a bridge network to dir, the pod
+// gets masqueraded access to the outside if the network provides the
+// default route. Without subnet, the /24 of a static ip or the first free
+// /24 of 10.100.0.0/16 is used. It returns the path of the config.
+func CreateNetwork(runner Runner, network *Network, subnet, dir string) (string, error) {
+	paths, err := CreateNetworks(runner, []*Network{network}, subnet, dir)
+	if err != nil {
+		return "", err
+	}
+	return paths[0], nil
+}
+
+// CreateNetworks creates the configs of several networks like CreateNetwork.
+// The networks created first are taken into account when picking subnets
+// and bridges, also in dry-run mode where no config gets written.
+func CreateNetworks(runner Runner, networks []*Network, subnet, dir string) ([]string, error) {
+	configs, err := readNetworkConfigs(dir)
+	if err != nil {
+		return nil, err
+	}
+	paths := make([]string, len(networks))
+	for idx, network := range networks {
+		if paths[idx], err = createNetwork(runner, network, subnet, dir, configs); err != nil {
+			return nil, err
+		}
+	}
+	return paths, nil
+}
+
+// createNetwork writes the config of network and adds it to configs
+func createNetwork(runner Runner, network *Network, subnet, dir string, configs map[string]*cniConfig) (string, error) {
+	if builtinNetworks[network.Name] {
+		return "", fmt.Errorf("network %v is built into rkt", network.Name)
+	}
+	if configs[network.Name] != nil {
+		return "", fmt.Errorf("network %v already exists", network.Name)
+	}
+	ipNet, err := networkSubnet(network, subnet, configs)
+	if err != nil {
+		return "", fmt.Errorf("network %v: %v", network.Name, err)
+	}
+	bridge, err := bridgeName(network.Name, configs)
+	if err != nil {
+		return "", fmt.Errorf("network %v: %v", network.Name, err)
+	}
+	ipam := map[string]interface{}{"type": "host-local", "subnet": ipNet.String()}
+	if boolValue(network.DefaultRoute) {
+		ipam["routes"] = []map[string]string{{"dst": "0.0.0.0/0"}}
+	}
+	config := map[string]interface{}{
+		"name":      network.Name,
+		"type":      "bridge",
+		"bridge":    bridge,
+		"isGateway": true,
+		"ipMasq":    boolValue(network.DefaultRoute),
+		"ipam":      ipam,
+	}
+	bs, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	created := &cniConfig{}
+	if err := json.Unmarshal(bs, created); err != nil {
+		return "", err
+	}
+	configs[network.Name] = created
+	path := filepath.Join(dir, network.Name+".conf")
+	if dryRun(runner) {
+		log.Printf("dry-run: would write network config %v:\n%s", path, bs)
+		return path, nil
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	if err := ioutil.WriteFile(path, append(bs, '\n'), 0644); err != nil {
+		return "", err
+	}
+	log.Printf("created network %v with subnet %v in %v", network.Name, ipNet, path)
+	return path, nil
+}
+
+// bridgeName returns the name of the bridge of a new network. Long names
+// are truncated to the maximum length of interface names and get a hash
+// suffix, so that networks sharing a prefix get different bridges.
+func bridgeName(name string, configs map[string]*cniConfig) (string, error) {
+	bridge := "rkt-" + name
+	if len(bridge) > 15 {
+		sum := sha256.Sum256([]byte(name))
+		bridge = fmt.Sprintf("%v-%x", bridge[:10], sum[:2])
+	}
+	for other, config := range configs {
+		if config.Bridge == bridge {
+			return "", fmt.Errorf("bridge %v is already used by network %v", bridge, other)
+		}
+	}
+	return bridge, nil
+}
+
+// networkSubnet picks the subnet of a new network, it must not overlap
+// with the subnets of the existing networks
+func networkSubnet(network *Network, subnet string, configs map[string]*cniConfig) (*net.IPNet, error) {
+	overlapping := func(candidate *net.IPNet) string {
+		for name, config := range configs {
+			_, ipNet, err := net.ParseCIDR(config.IPAM.Subnet)
+			if err == nil && (ipNet.Contains(candidate.IP) || candidate.Contains(ipNet.IP)) {
+				return name
+			}
+		}
+		return ""
+	}
+	ip := net.ParseIP(network.IP)
+	var ipNet *net.IPNet
+	switch {
+	case subnet != "":
+		var err error
+		if _, ipNet, err = net.ParseCIDR(subnet); err != nil {
+			return nil, fmt.Errorf("invalid subnet %q", subnet)
+		}
+		if ip != nil && !ipNet.Contains(ip) {
+			return nil, fmt.Errorf("ip %v is not in subnet %v", ip, ipNet)
+		}
+	case ip != nil:
+		if ip.To4() == nil {
+			return nil, fmt.Errorf("a subnet is needed for ipv6 address %v", ip)
+		}
+		ipNet = &net.IPNet{IP: ip.Mask(net.CIDRMask(24, 32)), Mask: net.CIDRMask(24, 32)}
+	default:
+		for n := 0; n < 256; n++ {
+			candidate := &net.IPNet{IP: net.IPv4(10, 100, byte(n), 0).To4(), Mask: net.CIDRMask(24, 32)}
+			if overlapping(candidate) == "" {
+				return candidate, nil
+			}
+		}
+		return nil, fmt.Errorf("no free subnet found in 10.100.0.0/16, specify one")
+	}
+	if name := overlapping(ipNet); name != "" {
+		return nil, fmt.Errorf("subnet %v overlaps with network %v", ipNet, name)
+	}
+	return ipNet, nil
+}
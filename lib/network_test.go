@@ -0,0 +1,195 @@
+package lib
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testNetworksYAML = `
+name: test
+networks:
+  - frontend
+  - name: backend
+    ip: 10.1.2.3
+    args:
+      MAC: "02:42:0a:01:02:03"
+    defaultRoute: true
+manifest:
+  apps:
+    - name: web
+      image:
+        name: web
+`
+
+func TestNetworks(t *testing.T) {
+	path, cleanup := writeComposeFile(t, testNetworksYAML)
+	defer cleanup()
+	composeFile, err := NewComposeFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if arg := netArg(composeFile.Networks); arg != "--net=frontend,backend:IP=10.1.2.3;MAC=02:42:0a:01:02:03" {
+		t.Errorf("unexpected net arg %q", arg)
+	}
+	bs, err := json.Marshal(composeFile.Networks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := `["frontend",{"name":"backend","ip":"10.1.2.3","args":{"MAC":"02:42:0a:01:02:03"},"defaultRoute":true}]`; string(bs) != expected {
+		t.Errorf("expected %v, got %s", expected, bs)
+	}
+
+	override := filepath.Join(filepath.Dir(path), "override.yaml")
+	ioutil.WriteFile(override, []byte("networks:\n  - name: frontend\n    ip: 10.1.3.3\n  - backend\n"), 0644)
+	composeFile, err = NewComposeFile(path, override)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if arg := netArg(composeFile.Networks); arg != "--net=frontend:IP=10.1.3.3,backend:IP=10.1.2.3;MAC=02:42:0a:01:02:03" {
+		t.Errorf("unexpected net arg after merge %q", arg)
+	}
+}
+
+func TestNetworksValidation(t *testing.T) {
+	tests := map[string]string{
+		"  - host\n  - frontend\n":                                 "3: networks[host]: network mode host can not be combined with other networks",
+		"  - name: none\n    ip: 10.1.2.3\n":                       "3: networks[none]: network mode none does not take ip, args or defaultRoute",
+		"  - name: backend\n    ip: 10.1.2\n":                      "4: networks[backend].ip: invalid ip \"10.1.2\"",
+		"  - name: backend\n    args: {ip: x}\n":                   "4: networks[backend].args: use ip instead of arg ip",
+		"  - name: backend\n    args: {K: \"a;b\"}\n":              "4: networks[backend].args.K: value \"a;b\" must not contain ; or ,",
+		"  - frontend\n  - frontend\n":                             "4: networks[1].name: duplicate name \"frontend\"",
+		"  - default\n  - name: backend\n    defaultRoute: true\n": "5: networks[backend].defaultRoute: network default already provides the default route",
+	}
+	for networks, expected := range tests {
+		path, cleanup := writeComposeFile(t, "name: test\nnetworks:\n"+networks)
+		_, err := NewComposeFile(path)
+		cleanup()
+		if err == nil || !strings.HasSuffix(err.Error(), "rkt-compose.yaml:"+expected) {
+			t.Errorf("expected %q, got %v", expected, err)
+		}
+	}
+}
+
+func TestCreateNetwork(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rkt-compose-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	runner := newFakeRunner(nil)
+	ioutil.WriteFile(filepath.Join(dir, "existing.conf"), []byte(`{"name": "existing", "ipam": {"subnet": "10.100.0.0/16"}}`), 0644)
+
+	yes := true
+	networks := []*Network{{Name: "default"}, {Name: "existing"}, {Name: "backend", DefaultRoute: &yes}, {Name: "frontend-network", IP: "10.1.2.3"}}
+	missing, err := MissingNetworks(networks, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(missing) != 2 || missing[0].Name != "backend" || missing[1].Name != "frontend-network" {
+		t.Fatalf("expected backend and frontend-network to be missing, got %v", missing)
+	}
+	if _, err := CreateNetwork(runner, missing[0], "", dir); err == nil || err.Error() != "network backend: no free subnet found in 10.100.0.0/16, specify one" {
+		t.Errorf("expected no free subnet, got %v", err)
+	}
+	if _, err := CreateNetwork(runner, missing[1], "10.2.0.0/16", dir); err == nil || err.Error() != "network frontend-network: ip 10.1.2.3 is not in subnet 10.2.0.0/16" {
+		t.Errorf("expected the ip to be checked, got %v", err)
+	}
+	if _, err := CreateNetwork(runner, &Network{Name: "other"}, "10.100.8.0/22", dir); err == nil || err.Error() != "network other: subnet 10.100.8.0/22 overlaps with network existing" {
+		t.Errorf("expected overlapping subnets to be refused, got %v", err)
+	}
+	os.Remove(filepath.Join(dir, "existing.conf"))
+
+	expected := map[string]string{
+		"backend":          `{"bridge":"rkt-backend","ipMasq":true,"ipam":{"routes":[{"dst":"0.0.0.0/0"}],"subnet":"10.100.0.0/24","type":"host-local"},"isGateway":true,"name":"backend","type":"bridge"}`,
+		"frontend-network": `{"bridge":"rkt-fronte-abac","ipMasq":false,"ipam":{"subnet":"10.1.2.0/24","type":"host-local"},"isGateway":true,"name":"frontend-network","type":"bridge"}`,
+	}
+	for _, network := range missing {
+		path, err := CreateNetwork(runner, network, "", dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		config := map[string]interface{}{}
+		bs, _ := ioutil.ReadFile(path)
+		if err := json.Unmarshal(bs, &config); err != nil {
+			t.Fatal(err)
+		}
+		bs, _ = json.Marshal(config)
+		if string(bs) != expected[network.Name] {
+			t.Errorf("expected config %v, got %s", expected[network.Name], bs)
+		}
+	}
+	if _, err := CreateNetwork(runner, &Network{Name: "other"}, "", dir); err != nil {
+		t.Fatal(err)
+	}
+	configs, _ := readNetworkConfigs(dir)
+	if subnet := configs["other"].IPAM.Subnet; subnet != "10.100.1.0/24" {
+		t.Errorf("expected the next free subnet, got %v", subnet)
+	}
+	if _, err := CreateNetwork(runner, &Network{Name: "backend"}, "", dir); err == nil || err.Error() != "network backend already exists" {
+		t.Errorf("expected backend to exist, got %v", err)
+	}
+
+	// truncated names sharing a prefix get different bridges
+	if _, err := CreateNetwork(runner, &Network{Name: "frontend-netdev"}, "", dir); err != nil {
+		t.Fatal(err)
+	}
+	configs, _ = readNetworkConfigs(dir)
+	if bridge := configs["frontend-netdev"].Bridge; bridge != "rkt-fronte-e1a5" {
+		t.Errorf("expected a hash suffix, got %v", bridge)
+	}
+	ioutil.WriteFile(filepath.Join(dir, "manual.conf"), []byte(`{"name": "manual", "bridge": "rkt-web", "ipam": {"subnet": "10.200.0.0/24"}}`), 0644)
+	if _, err := CreateNetwork(runner, &Network{Name: "web"}, "", dir); err == nil || err.Error() != "network web: bridge rkt-web is already used by network manual" {
+		t.Errorf("expected the bridge to be refused, got %v", err)
+	}
+}
+
+func TestCreateNetworksDryRun(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rkt-compose-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	output := &bytes.Buffer{}
+	log.SetOutput(output)
+	defer log.SetOutput(os.Stderr)
+
+	runner := &DryRunner{Runner: newFakeRunner(nil)}
+	if _, err := CreateNetworks(runner, []*Network{{Name: "backend"}, {Name: "frontend"}}, "", dir); err != nil {
+		t.Fatal(err)
+	}
+	for _, subnet := range []string{`"subnet": "10.100.0.0/24"`, `"subnet": "10.100.1.0/24"`} {
+		if !strings.Contains(output.String(), subnet) {
+			t.Errorf("expected the networks to get different subnets, got\n%v", output)
+		}
+	}
+	if paths, _ := filepath.Glob(filepath.Join(dir, "*")); len(paths) != 0 {
+		t.Errorf("expected no configs to be written, got %v", paths)
+	}
+}
+
+func TestCheckDefaultRoutes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rkt-compose-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	yes := true
+	ioutil.WriteFile(filepath.Join(dir, "manual.conf"), []byte(`{"name": "manual", "ipam": {"subnet": "10.200.0.0/24"}}`), 0644)
+	if _, err := CreateNetwork(newFakeRunner(nil), &Network{Name: "backend", DefaultRoute: &yes}, "", dir); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := CheckDefaultRoutes([]*Network{{Name: "backend", DefaultRoute: &yes}, {Name: "manual"}, {Name: "missing", DefaultRoute: &yes}}, dir); err != nil {
+		t.Errorf("expected the default route to be provided, got %v", err)
+	}
+	expected := "network manual should provide the default route, but its config in " + dir + " has no route to 0.0.0.0/0"
+	if err := CheckDefaultRoutes([]*Network{{Name: "manual", DefaultRoute: &yes}}, dir); err == nil || err.Error() != expected {
+		t.Errorf("expected %q, got %v", expected, err)
+	}
+}
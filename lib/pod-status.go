@@ -0,0 +1,281 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/appc/spec/schema"
+)
+
+// PodStatus combines the state of the systemd unit with the state rkt
+// reports for the pod and its apps
+type PodStatus struct {
+	Name string `json:"name"`
+	UUID string `json:"uuid,omitempty"`
+	// State is the state of the pod as reported by rkt, e.g. "running"
+	State     string          `json:"state"`
+	StartedAt *time.Time      `json:"startedAt,omitempty"`
+	Unit      *UnitState      `json:"unit,omitempty"`
+	Networks  []NetworkStatus `json:"networks,omitempty"`
+	Ports     []PortStatus    `json:"ports,omitempty"`
+	Apps      []AppStatus     `json:"apps"`
+}
+
+// NetworkStatus is the address of the pod in one network
+type NetworkStatus struct {
+	Name string `json:"name"`
+	IP   string `json:"ip"`
+}
+
+// PortStatus is a port of an app forwarded from the host
+type PortStatus struct {
+	App      string `json:"app,omitempty"`
+	Name     string `json:"name"`
+	Port     uint   `json:"port,omitempty"`
+	Protocol string `json:"protocol,omitempty"`
+	// HostIP is empty if the port is forwarded from all addresses
+	HostIP   string `json:"hostIP,omitempty"`
+	HostPort uint   `json:"hostPort"`
+}
+
+// Host returns the address the port is forwarded from
+func (port *PortStatus) Host() string {
+	ip := port.HostIP
+	if ip == "" {
+		ip = "0.0.0.0"
+	}
+	return net.JoinHostPort(ip, fmt.Sprint(port.HostPort))
+}
+
+// AppStatus is the state of a single app of the pod
+type AppStatus struct {
+	Name     string `json:"name"`
+	State    string `json:"state"`
+	ExitCode *int   `json:"exitCode,omitempty"`
+	ImageID  string `json:"imageID,omitempty"`
+	// Health is the result of the last health checks, if any
+	Health string `json:"health,omitempty"`
+}
+
+// rktPod is the subset of the json output of `rkt status` which is used here
+type rktPod struct {
+	UUID     string   `json:"name"`
+	State    string   `json:"state"`
+	AppNames []string `json:"app_names"`
+	Networks []struct {
+		NetName string `json:"netName"`
+		IP      string `json:"ip"`
+	} `json:"networks"`
+	StartedAt *int64 `json:"started_at"`
+}
+
+// GetPodStatus collects the status of the pod called name.
+// The uuid is read from uuidFile, the resolved image ids from the pod
+// manifest at manifestPath and the results of health checks from
+// healthFile. Parts which are not available (e.g. because the pod never
+// ran) are left empty.
+func GetPodStatus(runner Runner, name, uuidFile, manifestPath, healthFile string) (*PodStatus, error) {
+	status := &PodStatus{Name: name, State: "unknown", Apps: []AppStatus{}}
+	unit, err := GetUnitState(runner, name)
+	if err != nil {
+		return nil, fmt.Errorf("can not get state of unit %v: %v", name, err)
+	}
+	status.Unit = unit
+
+	if bs, err := ioutil.ReadFile(manifestPath); err == nil {
+		manifest := &schema.PodManifest{}
+		if err := json.Unmarshal(bs, manifest); err != nil {
+			return nil, fmt.Errorf("can not parse pod manifest %v: %v", manifestPath, err)
+		}
+		for _, app := range manifest.Apps {
+			status.Apps = append(status.Apps, AppStatus{
+				Name:    app.Name.String(),
+				ImageID: app.Image.ID.String(),
+			})
+		}
+		status.Ports = portStatus(manifest)
+	}
+
+	uuid, err := readPodUUID(uuidFile)
+	if err != nil {
+		// the pod was never started from this directory
+		return status, nil
+	}
+	status.UUID = uuid
+	if health, err := ReadPodHealth(healthFile, uuid); err == nil {
+		// applied last, as apps may still be added from the output of rkt
+		defer status.setHealth(health)
+	}
+
+	pod := &rktPod{}
+	if err := rktJSON(runner, pod, "status", "--format=json", status.UUID); err != nil {
+		// the pod may already be garbage collected
+		return status, nil
+	}
+	status.State = pod.State
+	if pod.StartedAt != nil {
+		// rkt reports seconds since the epoch
+		startedAt := time.Unix(*pod.StartedAt, 0)
+		status.StartedAt = &startedAt
+	}
+	for _, network := range pod.Networks {
+		status.Networks = append(status.Networks, NetworkStatus{Name: network.NetName, IP: network.IP})
+	}
+
+	exitCodes := map[string]int{}
+	if pod.State != "running" {
+		// rkt only reports the exit codes of apps in its plain output,
+		// once the pod is no longer running
+		stdout, err := runQuery(runner, "rkt", "status", status.UUID)
+		if err != nil {
+			return nil, err
+		}
+		exitCodes = parseAppExitCodes(stdout)
+	}
+	status.setAppStates(pod, exitCodes)
+	return status, nil
+}
+
+// parseAppExitCodes reads the app-<name>=<code> lines of `rkt status`
+func parseAppExitCodes(output string) map[string]int {
+	exitCodes := map[string]int{}
+	for _, line := range strings.Split(output, "\n") {
+		parts := strings.SplitN(strings.TrimSpace(line), "=", 2)
+		if len(parts) != 2 || !strings.HasPrefix(parts[0], "app-") {
+			continue
+		}
+		if code, err := strconv.Atoi(parts[1]); err == nil {
+			exitCodes[strings.TrimPrefix(parts[0], "app-")] = code
+		}
+	}
+	return exitCodes
+}
+
+// portStatus lists the ports the pod manifest forwards from the host
+func portStatus(manifest *schema.PodManifest) []PortStatus {
+	ports := []PortStatus{}
+	for _, exposed := range manifest.Ports {
+		port := PortStatus{Name: exposed.Name.String(), HostPort: exposed.HostPort}
+		if exposed.HostIP != nil && !exposed.HostIP.IsUnspecified() {
+			port.HostIP = exposed.HostIP.String()
+		}
+		for _, app := range manifest.Apps {
+			if app.App == nil {
+				continue
+			}
+			for _, appPort := range app.App.Ports {
+				if appPort.Name == exposed.Name {
+					port.App, port.Port, port.Protocol = app.Name.String(), appPort.Port, appPort.Protocol
+				}
+			}
+		}
+		ports = append(ports, port)
+	}
+	return ports
+}
+
+// setAppStates sets the states of the apps of the pod. rkt does not track
+// the state of single apps, they share the state of the pod, apps with an
+// exit code have exited.
+func (status *PodStatus) setAppStates(pod *rktPod, exitCodes map[string]int) {
+	for _, name := range pod.AppNames {
+		idx := -1
+		for i := range status.Apps {
+			if status.Apps[i].Name == name {
+				idx = i
+				break
+			}
+		}
+		if idx < 0 {
+			status.Apps = append(status.Apps, AppStatus{Name: name})
+			idx = len(status.Apps) - 1
+		}
+		status.Apps[idx].State = pod.State
+		if code, ok := exitCodes[name]; ok {
+			status.Apps[idx].State = "exited"
+			status.Apps[idx].ExitCode = &code
+		}
+	}
+}
+
+// setHealth copies the health of the apps
+func (status *PodStatus) setHealth(health *PodHealth) {
+	for idx := range status.Apps {
+		if app := health.App(status.Apps[idx].Name); app != nil {
+			status.Apps[idx].Health = app.Status
+		}
+	}
+}
+
+// WriteTable prints the status in a human readable form
+func (status *PodStatus) WriteTable(output io.Writer) error {
+	w := tabwriter.NewWriter(output, 0, 8, 2, ' ', 0)
+	unitState, restarts, lastExit := "-", "-", "-"
+	if status.Unit != nil {
+		unitState = fmt.Sprintf("%v (%v)", status.Unit.ActiveState, status.Unit.SubState)
+		restarts = fmt.Sprint(status.Unit.Restarts)
+		if status.Unit.ExitCode != "" {
+			lastExit = status.Unit.ExitCode
+		}
+	}
+	startedAt := "-"
+	if status.StartedAt != nil {
+		startedAt = status.StartedAt.Format(time.RFC3339)
+	}
+	fmt.Fprintln(w, "POD\tUUID\tSTATE\tSTARTED\tUNIT\tRESTARTS\tLAST EXIT")
+	fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\t%v\t%v\n",
+		status.Name, orDash(status.UUID), status.State, startedAt, unitState, restarts, lastExit)
+	if len(status.Networks) > 0 {
+		fmt.Fprintln(w, "\nNETWORK\tIP")
+		for _, network := range status.Networks {
+			fmt.Fprintf(w, "%v\t%v\n", network.Name, network.IP)
+		}
+	}
+	if len(status.Ports) > 0 {
+		fmt.Fprintln(w, "\nHOST\tAPP\tPORT\tNAME")
+		for _, port := range status.Ports {
+			appPort := "-"
+			if port.App != "" {
+				appPort = fmt.Sprintf("%v/%v", port.Port, port.Protocol)
+			}
+			fmt.Fprintf(w, "%v\t%v\t%v\t%v\n", port.Host(), orDash(port.App), appPort, port.Name)
+		}
+	}
+	if len(status.Apps) > 0 {
+		fmt.Fprintln(w, "\nAPP\tSTATE\tHEALTH\tEXIT CODE\tIMAGE")
+		for _, app := range status.Apps {
+			exitCode := "-"
+			if app.ExitCode != nil {
+				exitCode = fmt.Sprint(*app.ExitCode)
+			}
+			fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\n", app.Name, orDash(app.State), orDash(app.Health), exitCode, orDash(app.ImageID))
+		}
+	}
+	return w.Flush()
+}
+
+func orDash(str string) string {
+	if str == "" {
+		return "-"
+	}
+	return str
+}
+
+// rktJSON runs rkt with args and decodes its json output into v
+func rktJSON(runner Runner, v interface{}, args ...string) error {
+	stdout, err := runQuery(runner, "rkt", args...)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal([]byte(stdout), v); err != nil {
+		return fmt.Errorf("rkt %v: can not parse output: %v", strings.Join(args, " "), err)
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// the output of rkt 1.30 for a pod running etcd and redis
+const rktStatusJSON = `{"name":"5bc080ca-3589-4c0b-9a3d-2f1d4d0d3a8b","state":"running","networks":[{"netName":"default","netConf":"net/99-default.conf","pluginPath":"stage1/rootfs/usr/lib/rkt/plugins/net/ptp","ifName":"eth0","ip":"172.16.28.2","args":"","mask":"255.255.255.0"}],"app_names":["etcd","redis"],"created_at":1474279800,"started_at":1474279801,"pid":5829}`
+
+// the output of rkt 1.30 once etcd exited and redis got killed
+const (
+	rktExitedStatusJSON = `{"name":"5bc080ca-3589-4c0b-9a3d-2f1d4d0d3a8b","state":"exited","networks":[{"netName":"default","netConf":"net/99-default.conf","pluginPath":"stage1/rootfs/usr/lib/rkt/plugins/net/ptp","ifName":"eth0","ip":"172.16.28.2","args":"","mask":"255.255.255.0"}],"app_names":["etcd","redis"],"created_at":1474279800,"started_at":1474279801,"pid":5829}`
+	rktExitedStatus     = `state=exited
+created=2016-09-19 10:10:00.000 +0000 UTC
+started=2016-09-19 10:10:01.000 +0000 UTC
+networks=default:ip4=172.16.28.2
+pid=5829
+exited=true
+app-etcd=0
+app-redis=137
+`
+)
+
+func TestGetPodStatus(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rkt-compose-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	uuidFile, manifestPath := filepath.Join(dir, ".pod-uuid"), filepath.Join(dir, "pod-manifest.json")
+	if err := ioutil.WriteFile(uuidFile, []byte("5bc080ca-3589-4c0b-9a3d-2f1d4d0d3a8b\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	manifest := `{"acVersion":"0.8.11","acKind":"PodManifest","apps":[` +
+		`{"name":"etcd","image":{"id":"` + testImageID + `"},"app":{"exec":["/etcd"],"user":"0","group":"0","ports":[{"name":"client","protocol":"tcp","port":2379,"count":1}]}},` +
+		`{"name":"redis","image":{"id":"` + otherImageID + `"}}],` +
+		`"ports":[{"name":"client","hostPort":12379}]}`
+	if err := ioutil.WriteFile(manifestPath, []byte(manifest), 0644); err != nil {
+		t.Fatal(err)
+	}
+	runner := newFakeRunner(func(cmd *Command) error {
+		switch cmd.Name + " " + cmd.Args[0] {
+		case "systemctl show":
+			fmt.Fprint(cmd.Stdout, "LoadState=loaded\nActiveState=active\nSubState=running\nNRestarts=1\nExecMainCode=0\nExecMainStatus=0\n")
+		case "rkt status":
+			fmt.Fprint(cmd.Stdout, rktStatusJSON)
+		}
+		return nil
+	})
+	status, err := GetPodStatus(runner, "test", uuidFile, manifestPath, filepath.Join(dir, "health.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.StartedAt == nil || !status.StartedAt.Equal(time.Date(2016, 9, 19, 10, 10, 1, 0, time.UTC)) {
+		t.Errorf("expected the pod to be started at 2016-09-19T10:10:01Z, got %v", status.StartedAt)
+	}
+	status.StartedAt = nil
+	bs, _ := json.Marshal(status)
+	expected := `{"name":"test","uuid":"5bc080ca-3589-4c0b-9a3d-2f1d4d0d3a8b","state":"running",` +
+		`"unit":{"loadState":"loaded","activeState":"active","subState":"running","restarts":1},` +
+		`"networks":[{"name":"default","ip":"172.16.28.2"}],` +
+		`"ports":[{"app":"etcd","name":"client","port":2379,"protocol":"tcp","hostPort":12379}],` +
+		`"apps":[{"name":"etcd","state":"running","imageID":"` + testImageID + `"},{"name":"redis","state":"running","imageID":"` + otherImageID + `"}]}`
+	if string(bs) != expected {
+		t.Errorf("expected %s\ngot      %s", expected, bs)
+	}
+
+	if calls := runner.Calls(); len(calls) != 2 {
+		t.Errorf("expected the exit codes not to be queried while the pod runs, got %q", calls)
+	}
+
+	runner = newFakeRunner(func(cmd *Command) error {
+		switch {
+		case cmd.Name == "systemctl":
+			fmt.Fprint(cmd.Stdout, "LoadState=loaded\nActiveState=inactive\nSubState=dead\n")
+		case cmd.Args[1] == "--format=json":
+			fmt.Fprint(cmd.Stdout, rktExitedStatusJSON)
+		default:
+			fmt.Fprint(cmd.Stdout, rktExitedStatus)
+		}
+		return nil
+	})
+	status, err = GetPodStatus(runner, "test", uuidFile, manifestPath, filepath.Join(dir, "health.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bs, _ = json.Marshal(status.Apps)
+	expected = `[{"name":"etcd","state":"exited","exitCode":0,"imageID":"` + testImageID + `"},{"name":"redis","state":"exited","exitCode":137,"imageID":"` + otherImageID + `"}]`
+	if string(bs) != expected {
+		t.Errorf("expected %s\ngot      %s", expected, bs)
+	}
+
+	// a garbage collected pod only has the state of the unit and the manifest
+	runner = newFakeRunner(func(cmd *Command) error {
+		if cmd.Name == "rkt" {
+			return exitStatus(254)
+		}
+		return nil
+	})
+	status, err = GetPodStatus(runner, "test", uuidFile, manifestPath, filepath.Join(dir, "health.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.State != "unknown" || status.StartedAt != nil || len(status.Apps) != 2 || status.Apps[0].State != "" {
+		t.Errorf("expected the pod state to be unknown, got %+v", status)
+	}
+}
@@ -0,0 +1,268 @@
+package lib
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/appc/spec/schema"
+	"github.com/appc/spec/schema/types"
+)
+
+// A PortMapping publishes a port of an app on the host. It is written as
+// [hostIP:]hostPort:port[/protocol], port being the number or the name of a
+// port of the app, e.g. 8080:80, 127.0.0.1:8443:https or [::1]:53:53/udp.
+type PortMapping struct {
+	// HostIP restricts the mapping to one address of the host, nil means all
+	HostIP   net.IP
+	HostPort uint
+	// Port is the number or the name of the port of the app
+	Port string
+	// Protocol defaults to tcp, or to the protocol of the named port
+	Protocol string
+}
+
+// ParsePortMapping parses the short port syntax
+func ParsePortMapping(str string) (*PortMapping, error) {
+	mapping := &PortMapping{}
+	spec := str
+	if idx := strings.LastIndex(spec, "/"); idx >= 0 {
+		spec, mapping.Protocol = spec[:idx], spec[idx+1:]
+		if mapping.Protocol != "tcp" && mapping.Protocol != "udp" {
+			return nil, fmt.Errorf("invalid port mapping %q: unknown protocol %q (must be tcp or udp)", str, mapping.Protocol)
+		}
+	}
+	var hostIP string
+	if strings.HasPrefix(spec, "[") {
+		end := strings.Index(spec, "]:")
+		if end < 0 {
+			return nil, fmt.Errorf("invalid port mapping %q: unterminated ipv6 address", str)
+		}
+		hostIP, spec = spec[1:end], spec[end+2:]
+	}
+	parts := strings.Split(spec, ":")
+	switch {
+	case len(parts) == 3 && hostIP == "":
+		hostIP, parts = parts[0], parts[1:]
+	case len(parts) != 2:
+		return nil, fmt.Errorf("invalid port mapping %q, expected [hostIP:]hostPort:port[/protocol]", str)
+	}
+	if hostIP != "" {
+		if mapping.HostIP = net.ParseIP(hostIP); mapping.HostIP == nil {
+			return nil, fmt.Errorf("invalid port mapping %q: invalid host ip %q", str, hostIP)
+		}
+	}
+	hostPort, err := strconv.ParseUint(parts[0], 10, 16)
+	if err != nil || hostPort == 0 {
+		return nil, fmt.Errorf("invalid port mapping %q: invalid host port %q", str, parts[0])
+	}
+	mapping.HostPort = uint(hostPort)
+	mapping.Port = parts[1]
+	if mapping.Port == "" {
+		return nil, fmt.Errorf("invalid port mapping %q: missing port", str)
+	}
+	return mapping, nil
+}
+
+func (mapping *PortMapping) String() string {
+	str := fmt.Sprintf("%v:%v", mapping.HostPort, mapping.Port)
+	if mapping.HostIP != nil {
+		str = net.JoinHostPort(mapping.HostIP.String(), str)
+	}
+	if mapping.Protocol != "" {
+		str += "/" + mapping.Protocol
+	}
+	return str
+}
+
+// appPort finds the port of app the mapping refers to. Ports given by
+// number which the app does not declare yield nil.
+func (mapping *PortMapping) appPort(app *RuntimeApp) (*types.Port, error) {
+	number, err := strconv.ParseUint(mapping.Port, 10, 16)
+	isNumber := err == nil
+	if isNumber && number == 0 {
+		return nil, fmt.Errorf("invalid port 0")
+	}
+	if app.App != nil {
+		for idx, port := range app.App.Ports {
+			if isNumber && uint64(port.Port) == number && port.Protocol == mapping.protocol(&port) {
+				return &app.App.Ports[idx], nil
+			}
+			if !isNumber && port.Name.String() == mapping.Port {
+				if mapping.Protocol != "" && mapping.Protocol != port.Protocol {
+					return nil, fmt.Errorf("port %v uses protocol %v", port.Name, port.Protocol)
+				}
+				return &app.App.Ports[idx], nil
+			}
+		}
+	}
+	if !isNumber {
+		return nil, fmt.Errorf("app %v has no port %q", app.Name, mapping.Port)
+	}
+	return nil, nil
+}
+
+// protocol returns the protocol of the mapping, port is the app port it
+// refers to or nil
+func (mapping *PortMapping) protocol(port *types.Port) string {
+	switch {
+	case mapping.Protocol != "":
+		return mapping.Protocol
+	case port != nil && port.Name.String() == mapping.Port:
+		return port.Protocol
+	}
+	return "tcp"
+}
+
+// newAppPort declares the port of a mapping given by number which the app
+// does not declare itself
+func (mapping *PortMapping) newAppPort(app types.ACName) types.Port {
+	number, _ := strconv.ParseUint(mapping.Port, 10, 16)
+	protocol := mapping.protocol(nil)
+	name := fmt.Sprintf("%v-%v-%v", app, protocol, number)
+	if sanitized, err := types.SanitizeACName(name); err == nil {
+		name = sanitized
+	}
+	return types.Port{Name: types.ACName(name), Protocol: protocol, Port: uint(number), Count: 1}
+}
+
+// publishPorts expands the published ports of the apps into exposed ports
+// of the appc manifest, declaring app ports where needed
+func (manifest *PodManifest) publishPorts(result *schema.PodManifest) error {
+	// copy the exposed ports, they are shared with the compose file
+	exposed := append([]types.ExposedPort{}, result.Ports...)
+	for idx, app := range manifest.Apps {
+		runtimeApp := &result.Apps[idx]
+		if len(app.Publish) > 0 {
+			runtimeApp.App.Ports = append([]types.Port{}, runtimeApp.App.Ports...)
+		}
+		for _, str := range app.Publish {
+			mapping, err := ParsePortMapping(str)
+			if err != nil {
+				return fmt.Errorf("app %v: %v", app.Name, err)
+			}
+			port, err := mapping.appPort(app)
+			if err != nil {
+				return fmt.Errorf("app %v: %v", app.Name, err)
+			}
+			if port == nil {
+				newPort := mapping.newAppPort(app.Name)
+				port = &newPort
+				// the port may be published on several host ports
+				if !hasPort(runtimeApp.App.Ports, newPort.Name) {
+					runtimeApp.App.Ports = append(runtimeApp.App.Ports, newPort)
+				}
+			}
+			exposed = append(exposed, types.ExposedPort{
+				Name:     port.Name,
+				HostPort: mapping.HostPort,
+				HostIP:   mapping.HostIP,
+			})
+		}
+	}
+	if len(exposed) > len(result.Ports) {
+		result.Ports = exposed
+	}
+	return nil
+}
+
+func hasPort(ports []types.Port, name types.ACName) bool {
+	for _, port := range ports {
+		if port.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// hostBinding is a port bound on the host
+type hostBinding struct {
+	ip       net.IP
+	port     uint
+	protocol string
+	owner    string
+}
+
+func (binding *hostBinding) conflicts(other *hostBinding) bool {
+	if binding.port != other.port || binding.protocol != other.protocol {
+		return false
+	}
+	// a binding to all addresses conflicts with every other one
+	return binding.allAddresses() || other.allAddresses() || binding.ip.Equal(other.ip)
+}
+
+func (binding *hostBinding) allAddresses() bool {
+	return binding.ip == nil || binding.ip.IsUnspecified()
+}
+
+func (binding *hostBinding) String() string {
+	ip := "*"
+	if !binding.allAddresses() {
+		ip = binding.ip.String()
+	}
+	return fmt.Sprintf("%v/%v", net.JoinHostPort(ip, fmt.Sprint(binding.port)), binding.protocol)
+}
+
+// checkPorts reports invalid port mappings and host ports which are
+// published more than once
+func (manifest *PodManifest) checkPorts(report func(path, format string, args ...interface{})) {
+	bindings := []*hostBinding{}
+	add := func(path string, binding *hostBinding) {
+		for _, other := range bindings {
+			if binding.conflicts(other) {
+				report(path, "host port %v is already published by %v", binding, other.owner)
+				return
+			}
+		}
+		bindings = append(bindings, binding)
+	}
+	for idx, exposed := range manifest.Ports {
+		protocol := "tcp"
+		if port := manifest.appPortByName(exposed.Name); port != nil {
+			protocol = port.Protocol
+		}
+		add(fmt.Sprintf("manifest.ports[%v]", idx), &hostBinding{
+			ip:       exposed.HostIP,
+			port:     exposed.HostPort,
+			protocol: protocol,
+			owner:    fmt.Sprintf("port %v", exposed.Name),
+		})
+	}
+	for _, app := range manifest.Apps {
+		for idx, str := range app.Publish {
+			path := fmt.Sprintf("manifest.apps[%v].publish[%v]", app.Name, idx)
+			mapping, err := ParsePortMapping(str)
+			if err != nil {
+				report(path, "%v", err)
+				continue
+			}
+			port, err := mapping.appPort(app)
+			if err != nil {
+				report(path, "%v", err)
+				continue
+			}
+			add(path, &hostBinding{
+				ip:       mapping.HostIP,
+				port:     mapping.HostPort,
+				protocol: mapping.protocol(port),
+				owner:    fmt.Sprintf("app %v", app.Name),
+			})
+		}
+	}
+}
+
+// appPortByName finds a port declared by any app
+func (manifest *PodManifest) appPortByName(name types.ACName) *types.Port {
+	for _, app := range manifest.Apps {
+		if app.App == nil {
+			continue
+		}
+		for idx := range app.App.Ports {
+			if app.App.Ports[idx].Name == name {
+				return &app.App.Ports[idx]
+			}
+		}
+	}
+	return nil
+}
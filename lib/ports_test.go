@@ -0,0 +1,112 @@
+package lib
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/appc/spec/schema/types"
+)
+
+func TestParsePortMapping(t *testing.T) {
+	tests := map[string]string{
+		"8080:80":             "8080:80",
+		"127.0.0.1:8443:443":  "127.0.0.1:8443:443",
+		"[::1]:53:dns/udp":    "[::1]:53:dns/udp",
+		"8080:http/tcp":       "8080:http/tcp",
+		"80":                  `invalid port mapping "80", expected [hostIP:]hostPort:port[/protocol]`,
+		"0:80":                `invalid port mapping "0:80": invalid host port "0"`,
+		"localhost:8080:80":   `invalid port mapping "localhost:8080:80": invalid host ip "localhost"`,
+		"8080:80/sctp":        `invalid port mapping "8080:80/sctp": unknown protocol "sctp" (must be tcp or udp)`,
+		"[::1:8080:80":        `invalid port mapping "[::1:8080:80": unterminated ipv6 address`,
+		"1.2.3.4:5:6:7":       `invalid port mapping "1.2.3.4:5:6:7", expected [hostIP:]hostPort:port[/protocol]`,
+		"127.0.0.1:65536:80":  `invalid port mapping "127.0.0.1:65536:80": invalid host port "65536"`,
+		"[::]:8080:80/tcp":    "[::]:8080:80/tcp",
+		"0.0.0.0:8080:80/udp": "0.0.0.0:8080:80/udp",
+	}
+	for str, expected := range tests {
+		mapping, err := ParsePortMapping(str)
+		result := ""
+		if err != nil {
+			result = err.Error()
+		} else {
+			result = mapping.String()
+		}
+		if result != expected {
+			t.Errorf("%v: expected %q, got %q", str, expected, result)
+		}
+	}
+}
+
+func TestPublishPorts(t *testing.T) {
+	appPorts := []types.Port{{Name: "http", Protocol: "tcp", Port: 80, Count: 1}}
+	composeFile := &ComposeFile{Manifest: PodManifest{Apps: []*RuntimeApp{
+		{
+			Name:    "web",
+			Image:   RuntimeImage{Name: "web"},
+			App:     &App{Exec: []string{"web"}, Ports: appPorts},
+			Publish: []string{"8080:http", "127.0.0.1:9090:80", "5353:53/udp", "5354:53/udp"},
+		},
+	}}}
+	if err := composeFile.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	manifest, err := composeFile.GetAppcPodManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ports := manifest.Apps[0].App.Ports
+	if len(ports) != 2 || ports[1].Name != "web-udp-53" || ports[1].Protocol != "udp" || ports[1].Port != 53 {
+		t.Errorf("expected a port to be declared for 53/udp, got %+v", ports)
+	}
+	if len(appPorts) != 1 || len(composeFile.Manifest.Apps[0].App.Ports) != 1 {
+		t.Errorf("expected the ports of the compose file to stay untouched")
+	}
+	expected := []string{"http 8080 <nil>", "http 9090 127.0.0.1", "web-udp-53 5353 <nil>", "web-udp-53 5354 <nil>"}
+	if len(manifest.Ports) != len(expected) {
+		t.Fatalf("expected %v exposed ports, got %+v", len(expected), manifest.Ports)
+	}
+	for idx, exposed := range manifest.Ports {
+		if str := strings.Join([]string{exposed.Name.String(), fmt.Sprint(exposed.HostPort), exposed.HostIP.String()}, " "); str != expected[idx] {
+			t.Errorf("expected exposed port %q, got %q", expected[idx], str)
+		}
+	}
+
+	status := portStatus(manifest)
+	if len(status) != 4 || status[1].Host() != "127.0.0.1:9090" || status[2].App != "web" || status[2].Port != 53 || status[2].Protocol != "udp" {
+		t.Errorf("unexpected port status %+v", status)
+	}
+}
+
+func TestPublishPortsValidation(t *testing.T) {
+	tests := map[string][]string{
+		`manifest.apps[db].publish[0]: host port 127.0.0.1:8080/tcp is already published by app web`:             {"8080:80", "127.0.0.1:8080:5432"},
+		`manifest.apps[db].publish[0]: host port 127.0.0.1:9000/tcp is already published by app web`:             {"0.0.0.0:9000:80", "127.0.0.1:9000:5432"},
+		`manifest.apps[db].publish[0]: host port 127.0.0.1:5432/tcp is already published by app web`:             {"127.0.0.1:5432:80", "127.0.0.1:5432:5432"},
+		`manifest.apps[db].publish[0]: app db has no port "postgres"`:                                            {"8080:80", "5432:postgres"},
+		`manifest.apps[web].publish[0]: invalid port mapping "8080", expected [hostIP:]hostPort:port[/protocol]`: {"8080", "5432:5432"},
+		`manifest.apps[db].publish[0]: host port *:5432/tcp is already published by port web-tcp-80`:             {"127.0.0.1:8080:80", "5432:5432"},
+	}
+	for expected, publish := range tests {
+		composeFile := &ComposeFile{Manifest: PodManifest{Apps: []*RuntimeApp{
+			{Name: "web", Image: RuntimeImage{Name: "web"}, Publish: publish[:1]},
+			{Name: "db", Image: RuntimeImage{Name: "db"}, Publish: publish[1:]},
+		}}}
+		if strings.HasSuffix(expected, "by port web-tcp-80") {
+			composeFile.Manifest.Ports = []types.ExposedPort{{Name: "web-tcp-80", HostPort: 5432}}
+		}
+		err := composeFile.Validate()
+		if err == nil || err.Error() != expected {
+			t.Errorf("expected %q, got %v", expected, err)
+		}
+	}
+
+	// different protocols and host addresses do not conflict
+	composeFile := &ComposeFile{Manifest: PodManifest{Apps: []*RuntimeApp{
+		{Name: "web", Image: RuntimeImage{Name: "web"}, Publish: []string{"53:53", "127.0.0.1:8080:80"}},
+		{Name: "dns", Image: RuntimeImage{Name: "dns"}, Publish: []string{"53:53/udp", "127.0.0.2:8080:80"}},
+	}}}
+	if err := composeFile.Validate(); err != nil {
+		t.Errorf("expected no conflicts, got %v", err)
+	}
+}
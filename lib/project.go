@@ -0,0 +1,260 @@
+package lib
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// ProjectFileName is the default name of a project file
+const ProjectFileName = "rkt-compose.project.yaml"
+
+// A Project groups several pods which are started in dependency order
+type Project struct {
+	Name string        `json:"name,omitempty"`
+	Pods []*ProjectPod `json:"pods"`
+}
+
+// A ProjectPod is a pod of a project, described by one or more compose files
+type ProjectPod struct {
+	// Name defaults to the name of the pod in its compose files
+	Name string `json:"name,omitempty"`
+	// Files are the compose files of the pod, relative to the project file
+	Files []string `json:"files"`
+	// DependsOn lists the pods which have to be started before this one
+	DependsOn []string `json:"dependsOn,omitempty"`
+
+	// ComposeFile is the merged compose file of the pod
+	ComposeFile *ComposeFile `json:"-"`
+}
+
+// NewProject reads a project file and the compose files of all its pods.
+// Problems like unknown dependencies or dependency cycles are returned as
+// ValidationErrors.
+func NewProject(path string) (*Project, error) {
+	bs, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, wrapError(ErrInvalidComposeFile, err)
+	}
+	doc := &yamlv3.Node{}
+	if err := yamlv3.Unmarshal(bs, doc); err != nil {
+		return nil, ValidationErrors{{File: path, Message: err.Error()}}
+	}
+	if problems := checkSchema(doc, reflect.TypeOf(Project{}), ""); len(problems) > 0 {
+		for _, problem := range problems {
+			problem.File = path
+		}
+		return nil, problems
+	}
+	project := &Project{}
+	if err := yaml.Unmarshal(bs, project); err != nil {
+		return nil, ValidationErrors{{File: path, Message: err.Error()}}
+	}
+
+	dir := filepath.Dir(path)
+	directories := map[string]string{}
+	for _, pod := range project.Pods {
+		files := make([]string, len(pod.Files))
+		for idx, file := range pod.Files {
+			files[idx] = file
+			if !filepath.IsAbs(file) {
+				files[idx] = filepath.Join(dir, file)
+			}
+		}
+		if len(files) == 0 {
+			continue
+		}
+		if pod.ComposeFile, err = NewComposeFile(files...); err != nil {
+			return nil, err
+		}
+		if pod.Name == "" {
+			pod.Name = pod.ComposeFile.Name
+		}
+		// the unit of the pod is named after it
+		pod.ComposeFile.Name = pod.Name
+		// manifest, lock and uuid files are kept in the project directory
+		if other, ok := directories[pod.ComposeFile.ProjectDirectory]; ok {
+			return nil, newError(ErrInvalidComposeFile, "%v: pods %v and %v share the project directory %v",
+				path, other, pod.Name, pod.ComposeFile.ProjectDirectory)
+		}
+		directories[pod.ComposeFile.ProjectDirectory] = pod.Name
+	}
+	if problems := project.validate(); len(problems) > 0 {
+		// reuse the lookup of compose files to report line numbers
+		source := &ComposeFile{sources: []*composeSource{{path: path, doc: doc}}}
+		for _, problem := range problems {
+			problem.File, problem.Line = source.locate(problem.Path)
+		}
+		return nil, problems
+	}
+	return project, nil
+}
+
+func (project *Project) validate() ValidationErrors {
+	problems := ValidationErrors{}
+	names := map[string]bool{}
+	for idx, pod := range project.Pods {
+		path := fmt.Sprintf("pods[%v]", idx)
+		switch {
+		case len(pod.Files) == 0:
+			problems = append(problems, &ValidationError{Path: path + ".files", Message: "at least one compose file is required"})
+		case pod.Name == "":
+			problems = append(problems, &ValidationError{Path: path + ".name", Message: "name is required"})
+		case names[pod.Name]:
+			problems = append(problems, &ValidationError{Path: path + ".name", Message: "duplicate pod " + pod.Name})
+		}
+		names[pod.Name] = true
+	}
+	for idx, pod := range project.Pods {
+		for depIdx, dep := range pod.DependsOn {
+			if !names[dep] {
+				problems = append(problems, &ValidationError{
+					Path:    fmt.Sprintf("pods[%v].dependsOn[%v]", idx, depIdx),
+					Message: "unknown pod " + dep,
+				})
+			}
+		}
+	}
+	if len(problems) > 0 {
+		return problems
+	}
+	if cycle := project.findCycle(); cycle != nil {
+		problems = append(problems, &ValidationError{
+			Path:    "pods",
+			Message: "dependency cycle: " + strings.Join(cycle, " -> "),
+		})
+	}
+	return problems
+}
+
+// Pod returns the pod with the given name or nil
+func (project *Project) Pod(name string) *ProjectPod {
+	for _, pod := range project.Pods {
+		if pod.Name == name {
+			return pod
+		}
+	}
+	return nil
+}
+
+// findCycle returns the pods forming a dependency cycle, starting and
+// ending with the same pod, or nil if there is none
+func (project *Project) findCycle() []string {
+	names := make([]string, len(project.Pods))
+	for idx, pod := range project.Pods {
+		names[idx] = pod.Name
+	}
+	return findCycle(names, func(name string) []string {
+		if pod := project.Pod(name); pod != nil {
+			return pod.DependsOn
+		}
+		return nil
+	})
+}
+
+// findCycle returns the first dependency cycle found among names, starting
+// and ending with the same name, or nil if there is none
+func findCycle(names []string, dependencies func(name string) []string) []string {
+	const (
+		visiting = iota + 1
+		done
+	)
+	state := map[string]int{}
+	stack := []string{}
+	var visit func(name string) []string
+	visit = func(name string) []string {
+		switch state[name] {
+		case visiting:
+			for idx, entry := range stack {
+				if entry == name {
+					return append(append([]string{}, stack[idx:]...), name)
+				}
+			}
+		case done:
+			return nil
+		}
+		state[name] = visiting
+		stack = append(stack, name)
+		for _, dep := range dependencies(name) {
+			if cycle := visit(dep); cycle != nil {
+				return cycle
+			}
+		}
+		stack = stack[:len(stack)-1]
+		state[name] = done
+		return nil
+	}
+	for _, name := range names {
+		if cycle := visit(name); cycle != nil {
+			return cycle
+		}
+	}
+	return nil
+}
+
+// StartOrder returns the pods ordered so that every pod comes after the pods
+// it depends on. Independent pods keep the order of the project file.
+func (project *Project) StartOrder() ([]*ProjectPod, error) {
+	if cycle := project.findCycle(); cycle != nil {
+		return nil, newError(ErrInvalidComposeFile, "dependency cycle: %v", strings.Join(cycle, " -> "))
+	}
+	started := map[string]bool{}
+	order := make([]*ProjectPod, 0, len(project.Pods))
+	for len(order) < len(project.Pods) {
+		added := false
+		for _, pod := range project.Pods {
+			if started[pod.Name] {
+				continue
+			}
+			ready := true
+			for _, dep := range pod.DependsOn {
+				ready = ready && started[dep]
+			}
+			if ready {
+				started[pod.Name] = true
+				order = append(order, pod)
+				added = true
+				break
+			}
+		}
+		if !added {
+			// projects built in code are not validated
+			return nil, project.orderError(started)
+		}
+	}
+	return order, nil
+}
+
+// orderError explains why the pods which are not started can not be ordered
+func (project *Project) orderError(started map[string]bool) error {
+	seen := map[string]bool{}
+	for _, pod := range project.Pods {
+		if seen[pod.Name] {
+			return newError(ErrInvalidComposeFile, "pod %v is defined more than once", pod.Name)
+		}
+		seen[pod.Name] = true
+		for _, dep := range pod.DependsOn {
+			if !started[pod.Name] && project.Pod(dep) == nil {
+				return newError(ErrInvalidComposeFile, "pod %v depends on unknown pod %v", pod.Name, dep)
+			}
+		}
+	}
+	return newError(ErrInvalidComposeFile, "can not order the pods")
+}
+
+// StopOrder returns the pods in reverse start order
+func (project *Project) StopOrder() ([]*ProjectPod, error) {
+	order, err := project.StartOrder()
+	if err != nil {
+		return nil, err
+	}
+	for i, j := 0, len(order)-1; i < j; i, j = i+1, j-1 {
+		order[i], order[j] = order[j], order[i]
+	}
+	return order, nil
+}
@@ -0,0 +1,121 @@
+package lib
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func testProject(deps map[string][]string, names ...string) *Project {
+	project := &Project{}
+	for _, name := range names {
+		project.Pods = append(project.Pods, &ProjectPod{Name: name, Files: []string{name + ".yaml"}, DependsOn: deps[name]})
+	}
+	return project
+}
+
+func podNames(pods []*ProjectPod) []string {
+	names := []string{}
+	for _, pod := range pods {
+		names = append(names, pod.Name)
+	}
+	return names
+}
+
+func TestProjectOrder(t *testing.T) {
+	project := testProject(map[string][]string{
+		"web":    {"db", "cache"},
+		"worker": {"db"},
+	}, "web", "worker", "db", "cache")
+	start, err := project.StartOrder()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"db", "worker", "cache", "web"}; !reflect.DeepEqual(podNames(start), expected) {
+		t.Errorf("start order: expected %v, got %v", expected, podNames(start))
+	}
+	stop, err := project.StopOrder()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"web", "cache", "worker", "db"}; !reflect.DeepEqual(podNames(stop), expected) {
+		t.Errorf("stop order: expected %v, got %v", expected, podNames(stop))
+	}
+}
+
+func TestProjectOrderUnknown(t *testing.T) {
+	tests := map[string]*Project{
+		"pod web depends on unknown pod db": testProject(map[string][]string{"web": {"db"}}, "web"),
+		"pod web is defined more than once": testProject(map[string][]string{"web": {"db"}}, "db", "web", "web"),
+	}
+	for expected, project := range tests {
+		_, err := project.StartOrder()
+		if !errors.Is(err, ErrInvalidComposeFile) || err.Error() != expected {
+			t.Errorf("expected %q, got %v", expected, err)
+		}
+	}
+}
+
+func TestProjectValidate(t *testing.T) {
+	tests := []struct {
+		project  *Project
+		expected string
+	}{
+		{testProject(map[string][]string{"a": {"b"}, "b": {"c"}, "c": {"a"}}, "a", "b", "c"), "dependency cycle: a -> b -> c -> a"},
+		{testProject(map[string][]string{"a": {"a"}}, "a"), "dependency cycle: a -> a"},
+		{testProject(map[string][]string{"a": {"missing"}}, "a"), "unknown pod missing"},
+		{testProject(nil, "a", "a"), "duplicate pod a"},
+	}
+	for _, test := range tests {
+		problems := test.project.validate()
+		if len(problems) != 1 || problems[0].Message != test.expected {
+			t.Errorf("expected %q, got %v", test.expected, problems)
+		}
+	}
+	if _, err := testProject(map[string][]string{"a": {"a"}}, "a").StartOrder(); !errors.Is(err, ErrInvalidComposeFile) {
+		t.Errorf("expected ErrInvalidComposeFile from StartOrder, got %v", err)
+	}
+}
+
+func TestNewProject(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rkt-compose-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"db/rkt-compose.yaml":  "name: database\nmanifest:\n  apps: []\n",
+		"web/rkt-compose.yaml": "name: web\nmanifest:\n  apps: []\n",
+		ProjectFileName:        "pods:\n  - files: [db/rkt-compose.yaml]\n  - files: [web/rkt-compose.yaml]\n    dependsOn: [db]\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, err = NewProject(filepath.Join(dir, ProjectFileName))
+	problems, ok := err.(ValidationErrors)
+	if !ok || len(problems) != 1 || problems[0].Line != 4 || !strings.Contains(problems[0].Message, "unknown pod db") {
+		t.Fatalf("expected unknown pod db at line 4, got %v", err)
+	}
+
+	files[ProjectFileName] = strings.Replace(files[ProjectFileName], "[db]", "[database]", 1)
+	ioutil.WriteFile(filepath.Join(dir, ProjectFileName), []byte(files[ProjectFileName]), 0644)
+	project, err := NewProject(filepath.Join(dir, ProjectFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := project.Pod("database")
+	if db == nil || db.ComposeFile.ProjectDirectory != filepath.Join(dir, "db") {
+		t.Errorf("expected pod database in %v, got %+v", filepath.Join(dir, "db"), db)
+	}
+}
@@ -0,0 +1,273 @@
+package lib
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/appc/spec/schema"
+	"github.com/appc/spec/schema/types"
+)
+
+// Apps taking part in dependency ordering share the readiness volume.
+// An app creates <app>.ready in it once its readiness probe succeeded,
+// dependent apps wait for these markers before running their exec.
+const (
+	readinessVolume = "rkt-compose-readiness"
+	readinessDir    = "/run/rkt-compose"
+)
+
+// A Readiness probe tells when an app is ready to serve its dependents.
+// Exactly one of TCP, HTTP and Exec has to be given. Probes run inside the
+// app, so the image needs /bin/sh and nc or bash for tcp probes and wget or
+// curl for http probes.
+type Readiness struct {
+	// TCP is a port on localhost which accepts connections once the app is ready
+	TCP int `json:"tcp,omitempty" yaml:"tcp,omitempty"`
+	// HTTP is an url which responds with a 2xx status once the app is ready
+	HTTP string `json:"http,omitempty" yaml:"http,omitempty"`
+	// Exec is a command which exits with 0 once the app is ready
+	Exec []string `json:"exec,omitempty" yaml:"exec,omitempty"`
+	// Interval is the delay between probes (default 1s)
+	Interval string `json:"interval,omitempty" yaml:"interval,omitempty"`
+	// Timeout is how long dependent apps wait for the app (default 2m)
+	Timeout string `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+}
+
+func (readiness *Readiness) merge(other *Readiness) {
+	if other.TCP != 0 || other.HTTP != "" || len(other.Exec) > 0 {
+		readiness.TCP, readiness.HTTP, readiness.Exec = other.TCP, other.HTTP, other.Exec
+	}
+	if other.Interval != "" {
+		readiness.Interval = other.Interval
+	}
+	if other.Timeout != "" {
+		readiness.Timeout = other.Timeout
+	}
+}
+
+// check validates the probe
+func (readiness *Readiness) check() error {
+	probes := 0
+	for _, set := range []bool{readiness.TCP != 0, readiness.HTTP != "", len(readiness.Exec) > 0} {
+		if set {
+			probes++
+		}
+	}
+	if probes != 1 {
+		return fmt.Errorf("exactly one of tcp, http and exec must be specified")
+	}
+	if readiness.TCP < 0 || readiness.TCP > 65535 {
+		return fmt.Errorf("invalid tcp port %v", readiness.TCP)
+	}
+	if _, err := readiness.interval(); err != nil {
+		return err
+	}
+	_, err := readiness.timeout()
+	return err
+}
+
+func (readiness *Readiness) interval() (time.Duration, error) {
+	return parseSeconds("interval", readiness.Interval, time.Second)
+}
+
+func (readiness *Readiness) timeout() (time.Duration, error) {
+	return parseSeconds("timeout", readiness.Timeout, 2*time.Minute)
+}
+
+// parseDuration parses the positive duration value, which defaults to
+// defaultValue if empty. name is used in the error message.
+func parseDuration(name, value string, defaultValue time.Duration) (time.Duration, error) {
+	if value == "" {
+		return defaultValue, nil
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration <= 0 {
+		return 0, fmt.Errorf("invalid %v %q", name, value)
+	}
+	return duration, nil
+}
+
+// parseSeconds is like parseDuration, but rounds up to whole seconds as the
+// generated scripts can only sleep that precisely
+func parseSeconds(name, value string, defaultValue time.Duration) (time.Duration, error) {
+	duration, err := parseDuration(name, value, defaultValue)
+	if err != nil {
+		return 0, err
+	}
+	if rest := duration % time.Second; rest != 0 {
+		duration += time.Second - rest
+	}
+	return duration, nil
+}
+
+// String describes the probe for error messages
+func (readiness *Readiness) String() string {
+	switch {
+	case readiness.TCP != 0:
+		return fmt.Sprintf("tcp port %v", readiness.TCP)
+	case readiness.HTTP != "":
+		return "http " + readiness.HTTP
+	}
+	return "exec " + strings.Join(readiness.Exec, " ")
+}
+
+// probe returns the shell command running the probe once
+func (readiness *Readiness) probe() string {
+	switch {
+	case readiness.TCP != 0:
+		port := fmt.Sprint(readiness.TCP)
+		return "if command -v nc >/dev/null 2>&1; then nc -z 127.0.0.1 " + port +
+			"; else bash -c 'exec 3<>/dev/tcp/127.0.0.1/" + port + "'; fi"
+	case readiness.HTTP != "":
+		url := shellQuote(readiness.HTTP)
+		return "if command -v wget >/dev/null 2>&1; then wget -q -O /dev/null " + url +
+			"; else curl -fsS -o /dev/null " + url + "; fi"
+	}
+	return shellJoin(readiness.Exec)
+}
+
+// orderedApps returns the apps which depend on others or are depended on.
+// Their exec gets wrapped by waitScript.
+func (manifest *PodManifest) orderedApps() map[types.ACName]bool {
+	ordered := map[types.ACName]bool{}
+	for _, app := range manifest.Apps {
+		if len(app.DependsOn) > 0 || app.Readiness != nil {
+			ordered[app.Name] = true
+		}
+		for _, dep := range app.DependsOn {
+			ordered[types.ACName(dep)] = true
+		}
+	}
+	return ordered
+}
+
+// waitScript returns the shell script wrapping the exec of app. It waits
+// until all dependencies are ready, then marks the app ready in the
+// background, either right away or once its readiness probe succeeds, and
+// finally replaces itself with the original exec passed as arguments.
+func (manifest *PodManifest) waitScript(app *RuntimeApp) (string, error) {
+	lines := []string{
+		"dir=" + readinessDir,
+		`wait_ready() {`,
+		`  waited=0`,
+		`  while [ ! -e "$dir/$1.ready" ]; do`,
+		`    if [ "$waited" -ge "$2" ]; then`,
+		`      echo "rkt-compose: app $0: dependency $1 did not become ready within $2s ($3)" >&2`,
+		`      exit 1`,
+		`    fi`,
+		`    sleep 1`,
+		`    waited=$((waited + 1))`,
+		`  done`,
+		`}`,
+	}
+	for _, dep := range app.DependsOn {
+		readiness := manifest.app(types.ACName(dep)).Readiness
+		timeout, desc := 2*time.Minute, "app started"
+		if readiness != nil {
+			var err error
+			if timeout, err = readiness.timeout(); err != nil {
+				return "", err
+			}
+			desc = readiness.String()
+		}
+		lines = append(lines, fmt.Sprintf("wait_ready %v %d %v", dep, timeout/time.Second, shellQuote(desc)))
+	}
+	marker := fmt.Sprintf(`touch "$dir/%v.ready"`, app.Name)
+	if app.Readiness == nil {
+		lines = append(lines, marker)
+	} else {
+		interval, err := app.Readiness.interval()
+		if err != nil {
+			return "", err
+		}
+		lines = append(lines,
+			"(",
+			fmt.Sprintf("  until { %v; } >/dev/null 2>&1; do sleep %d; done", app.Readiness.probe(), interval/time.Second),
+			"  "+marker,
+			") &",
+		)
+	}
+	lines = append(lines, `exec "$@"`)
+	return strings.Join(lines, "\n"), nil
+}
+
+// applyOrdering wraps the exec of all ordered apps in the appc manifest
+// with their wait script and mounts the readiness volume into them
+func (manifest *PodManifest) applyOrdering(result *schema.PodManifest) error {
+	ordered := manifest.orderedApps()
+	if len(ordered) == 0 {
+		return nil
+	}
+	// writable for all, apps may run as any user
+	mode, uid, gid := "0777", 0, 0
+	result.Volumes = append(result.Volumes, types.Volume{
+		Name: readinessVolume,
+		Kind: "empty",
+		Mode: &mode,
+		UID:  &uid,
+		GID:  &gid,
+	})
+	for idx, app := range manifest.Apps {
+		if !ordered[app.Name] {
+			continue
+		}
+		script, err := manifest.waitScript(app)
+		if err != nil {
+			return fmt.Errorf("app %v: %v", app.Name, err)
+		}
+		runtimeApp := &result.Apps[idx]
+		runtimeApp.App.Exec = append(types.Exec{"/bin/sh", "-c", script, app.Name.String()}, runtimeApp.App.Exec...)
+		runtimeApp.Mounts = append(runtimeApp.Mounts, schema.Mount{Volume: readinessVolume, Path: readinessDir})
+	}
+	return nil
+}
+
+// checkOrdering reports problems with the dependsOn and readiness settings
+// of the apps
+func (manifest *PodManifest) checkOrdering(report func(path, format string, args ...interface{})) {
+	ordered := manifest.orderedApps()
+	names := []string{}
+	for _, app := range manifest.Apps {
+		path := fmt.Sprintf("manifest.apps[%v]", app.Name)
+		names = append(names, app.Name.String())
+		for idx, dep := range app.DependsOn {
+			switch {
+			case dep == app.Name.String():
+				report(fmt.Sprintf("%v.dependsOn[%v]", path, idx), "app can not depend on itself")
+			case manifest.app(types.ACName(dep)) == nil:
+				report(fmt.Sprintf("%v.dependsOn[%v]", path, idx), "unknown app %v", dep)
+			}
+		}
+		if app.Readiness != nil {
+			if err := app.Readiness.check(); err != nil {
+				report(path+".readiness", "%v", err)
+			}
+		}
+		if ordered[app.Name] && (app.App == nil || len(app.App.Exec) == 0) {
+			report(path+".app.exec", "exec is required for apps with dependencies or dependents, as it gets wrapped to wait for them")
+		}
+	}
+	cycle := findCycle(names, func(name string) []string {
+		if app := manifest.app(types.ACName(name)); app != nil {
+			return app.DependsOn
+		}
+		return nil
+	})
+	if len(cycle) > 2 {
+		report("manifest.apps", "dependency cycle: %v", strings.Join(cycle, " -> "))
+	}
+}
+
+// shellQuote quotes str for a posix shell
+func shellQuote(str string) string {
+	return "'" + strings.Replace(str, "'", `'\''`, -1) + "'"
+}
+
+func shellJoin(args []string) string {
+	quoted := make([]string, len(args))
+	for idx, arg := range args {
+		quoted[idx] = shellQuote(arg)
+	}
+	return strings.Join(quoted, " ")
+}
@@ -0,0 +1,131 @@
+package lib
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/appc/spec/schema/types"
+)
+
+func testOrderedManifest() *PodManifest {
+	return &PodManifest{Apps: []*RuntimeApp{
+		{
+			Name:      "web",
+			App:       &App{Exec: types.Exec{"echo", "web started"}},
+			DependsOn: []string{"db"},
+		},
+		{
+			Name:      "db",
+			App:       &App{Exec: types.Exec{"true"}},
+			Readiness: &Readiness{Exec: []string{"test", "-e", "ready-flag"}, Timeout: "1s"},
+		},
+	}}
+}
+
+// runWaitScript runs the wait script of app with its readiness markers in dir
+func runWaitScript(t *testing.T, manifest *PodManifest, app *RuntimeApp, dir string) (string, error) {
+	script, err := manifest.waitScript(app)
+	if err != nil {
+		t.Fatal(err)
+	}
+	script = strings.Replace(script, "dir="+readinessDir, "dir="+dir, 1)
+	cmd := exec.Command("/bin/sh", append([]string{"-c", script, app.Name.String()}, app.App.Exec...)...)
+	cmd.Dir = dir
+	// a file instead of a pipe, background probes would keep that open
+	output, err := ioutil.TempFile(dir, "output")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(output.Name())
+	defer output.Close()
+	cmd.Stdout, cmd.Stderr = output, output
+	err = cmd.Run()
+	bs, _ := ioutil.ReadFile(output.Name())
+	return string(bs), err
+}
+
+func TestWaitScript(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rkt-compose-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	manifest := testOrderedManifest()
+	web, db := manifest.Apps[0], manifest.Apps[1]
+
+	output, err := runWaitScript(t, manifest, web, dir)
+	if err == nil || !strings.Contains(output, "app web: dependency db did not become ready within 1s (exec test -e ready-flag)") {
+		t.Errorf("expected web to fail waiting for db, got %v: %q", err, output)
+	}
+
+	if _, err := runWaitScript(t, manifest, db, dir); err != nil {
+		t.Fatal(err)
+	}
+	ioutil.WriteFile(filepath.Join(dir, "ready-flag"), nil, 0644)
+	marker := filepath.Join(dir, "db.ready")
+	for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(100 * time.Millisecond) {
+		if _, err := os.Stat(marker); err == nil {
+			break
+		}
+	}
+	output, err = runWaitScript(t, manifest, web, dir)
+	if err != nil || output != "web started\n" {
+		t.Errorf("expected web to start, got %v: %q", err, output)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "web.ready")); err != nil {
+		t.Errorf("expected web to be marked ready: %v", err)
+	}
+}
+
+func TestApplyOrdering(t *testing.T) {
+	composeFile := &ComposeFile{Manifest: *testOrderedManifest()}
+	composeFile.Manifest.Apps = append(composeFile.Manifest.Apps, &RuntimeApp{Name: "other", App: &App{Exec: types.Exec{"sleep"}}})
+	manifest, err := composeFile.GetAppcPodManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(manifest.Volumes) != 1 || manifest.Volumes[0].Name != readinessVolume {
+		t.Errorf("expected the readiness volume, got %v", manifest.Volumes)
+	}
+	web := manifest.Apps[0].App.Exec
+	if len(web) != 6 || web[0] != "/bin/sh" || web[3] != "web" || web[4] != "echo" {
+		t.Errorf("expected wrapped exec of web, got %q", web)
+	}
+	if len(manifest.Apps[0].Mounts) != 1 || len(manifest.Apps[2].Mounts) != 0 {
+		t.Errorf("expected the readiness volume to be mounted into web only, got %v, %v", manifest.Apps[0].Mounts, manifest.Apps[2].Mounts)
+	}
+	if other := manifest.Apps[2].App.Exec; len(other) != 1 {
+		t.Errorf("expected exec of other to be unchanged, got %q", other)
+	}
+}
+
+func TestCheckOrdering(t *testing.T) {
+	tests := []struct {
+		change   func(manifest *PodManifest)
+		expected string
+	}{
+		{func(m *PodManifest) { m.Apps[0].DependsOn = []string{"missing"} }, "manifest.apps[web].dependsOn[0]: unknown app missing"},
+		{func(m *PodManifest) { m.Apps[0].DependsOn = []string{"web"} }, "manifest.apps[web].dependsOn[0]: app can not depend on itself"},
+		{func(m *PodManifest) { m.Apps[1].DependsOn = []string{"web"} }, "manifest.apps: dependency cycle: web -> db -> web"},
+		{func(m *PodManifest) { m.Apps[1].Readiness.TCP = 5432 }, "manifest.apps[db].readiness: exactly one of tcp, http and exec must be specified"},
+		{func(m *PodManifest) { m.Apps[1].Readiness.Timeout = "soon" }, `manifest.apps[db].readiness: invalid timeout "soon"`},
+		{func(m *PodManifest) { m.Apps[1].App.Exec = nil }, "manifest.apps[db].app.exec: exec is required"},
+	}
+	for _, test := range tests {
+		manifest := testOrderedManifest()
+		test.change(manifest)
+		problems := []string{}
+		manifest.checkOrdering(func(path, format string, args ...interface{}) {
+			problems = append(problems, (&ValidationError{Path: path, Message: fmt.Sprintf(format, args...)}).Error())
+		})
+		if len(problems) != 1 || !strings.HasPrefix(problems[0], test.expected) {
+			t.Errorf("expected %q, got %q", test.expected, problems)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package lib
+
+import (
+	"fmt"
+
+	"github.com/appc/spec/schema/types"
+	"github.com/appc/spec/schema/types/resource"
+)
+
+// resourceIsolators builds the resource/cpu and resource/memory isolators
+// for the cpu and memory shorthands. A missing request defaults to the
+// limit and vice versa.
+func resourceIsolators(cpu, cpuRequest, memory, memoryRequest string) ([]types.Isolator, error) {
+	isolators := []types.Isolator{}
+	if cpu != "" || cpuRequest != "" {
+		request, limit, err := resourceRange("cpu", cpuRequest, cpu)
+		if err != nil {
+			return nil, err
+		}
+		iso, err := types.NewResourceCPUIsolator(request, limit)
+		if err != nil {
+			return nil, err
+		}
+		isolators = append(isolators, iso.AsIsolator())
+	}
+	if memory != "" || memoryRequest != "" {
+		request, limit, err := resourceRange("memory", memoryRequest, memory)
+		if err != nil {
+			return nil, err
+		}
+		iso, err := types.NewResourceMemoryIsolator(request, limit)
+		if err != nil {
+			return nil, err
+		}
+		isolators = append(isolators, iso.AsIsolator())
+	}
+	return isolators, nil
+}
+
+// resourceRange fills in defaults and checks that request <= limit
+func resourceRange(kind, request, limit string) (string, string, error) {
+	if request == "" {
+		request = limit
+	}
+	if limit == "" {
+		limit = request
+	}
+	req, err := resource.ParseQuantity(request)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid %v request %q: %v", kind, request, err)
+	}
+	lim, err := resource.ParseQuantity(limit)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid %v limit %q: %v", kind, limit, err)
+	}
+	if req.Cmp(lim) > 0 {
+		return "", "", fmt.Errorf("%v request %v is larger than the limit %v", kind, request, limit)
+	}
+	return request, limit, nil
+}
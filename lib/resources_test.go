@@ -0,0 +1,66 @@
+package lib
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestResourceRange(t *testing.T) {
+	tests := []struct {
+		request, limit       string
+		expRequest, expLimit string
+		expectedErr          string
+	}{
+		{"500m", "1", "500m", "1", ""},
+		{"1", "1", "1", "1", ""},
+		{"", "2", "2", "2", ""},
+		{"256Mi", "", "256Mi", "256Mi", ""},
+		{"1000m", "1", "1000m", "1", ""},
+		{"2", "1", "", "", "cpu request 2 is larger than the limit 1"},
+		{"1001m", "1", "", "", "cpu request 1001m is larger than the limit 1"},
+		{"lots", "1", "", "", `invalid cpu request "lots"`},
+		{"1", "lots", "", "", `invalid cpu limit "lots"`},
+	}
+	for _, test := range tests {
+		request, limit, err := resourceRange("cpu", test.request, test.limit)
+		switch {
+		case test.expectedErr != "":
+			if err == nil || !strings.HasPrefix(err.Error(), test.expectedErr) {
+				t.Errorf("%q/%q: expected error %q, got %v", test.request, test.limit, test.expectedErr, err)
+			}
+		case err != nil:
+			t.Errorf("%q/%q: unexpected error %v", test.request, test.limit, err)
+		case request != test.expRequest || limit != test.expLimit:
+			t.Errorf("%q/%q: expected %q/%q, got %q/%q", test.request, test.limit, test.expRequest, test.expLimit, request, limit)
+		}
+	}
+}
+
+func TestResourceIsolators(t *testing.T) {
+	tests := []struct {
+		cpu, cpuRequest, memory, memoryRequest string
+		expected                               string
+	}{
+		{"", "", "", "", `[]`},
+		{"1", "", "", "", `[{"name":"resource/cpu","value":{"default":false,"request":"1","limit":"1"}}]`},
+		{"2", "500m", "", "", `[{"name":"resource/cpu","value":{"default":false,"request":"500m","limit":"2"}}]`},
+		{"", "", "", "128Mi", `[{"name":"resource/memory","value":{"default":false,"request":"128Mi","limit":"128Mi"}}]`},
+		{"1", "", "1Gi", "512Mi", `[{"name":"resource/cpu","value":{"default":false,"request":"1","limit":"1"}},{"name":"resource/memory","value":{"default":false,"request":"512Mi","limit":"1Gi"}}]`},
+	}
+	for _, test := range tests {
+		isolators, err := resourceIsolators(test.cpu, test.cpuRequest, test.memory, test.memoryRequest)
+		if err != nil {
+			t.Errorf("%+v: unexpected error %v", test, err)
+			continue
+		}
+		bs, _ := json.Marshal(isolators)
+		if string(bs) != test.expected {
+			t.Errorf("%+v:\nexpected %s\ngot      %s", test, test.expected, bs)
+		}
+	}
+
+	if _, err := resourceIsolators("1", "", "256Mi", "1Gi"); err == nil || err.Error() != "memory request 1Gi is larger than the limit 256Mi" {
+		t.Errorf("expected the memory request to be checked, got %v", err)
+	}
+}
@@ -0,0 +1,109 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"time"
+)
+
+// A RestartPolicy configures if and how a pod gets restarted when it exits.
+// It can be given as a plain policy name or as a mapping.
+type RestartPolicy struct {
+	// Policy is one of no, on-failure (default) and always
+	Policy string `json:"policy,omitempty" yaml:"policy,omitempty"`
+	// MaxRetries limits the number of restarts, zero means unlimited
+	MaxRetries int `json:"maxRetries,omitempty" yaml:"maxRetries,omitempty"`
+	// Backoff is the delay before the first restart (default 1s)
+	Backoff string `json:"backoff,omitempty" yaml:"backoff,omitempty"`
+	// MaxBackoff enables exponential backoff: the delay doubles with every
+	// restart until it reaches MaxBackoff. This needs systemd 254 or newer.
+	MaxBackoff string `json:"maxBackoff,omitempty" yaml:"maxBackoff,omitempty"`
+}
+
+// UnmarshalJSON accepts the policy name as shorthand
+func (policy *RestartPolicy) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err == nil {
+		*policy = RestartPolicy{Policy: name}
+		return nil
+	}
+	type restartPolicy RestartPolicy
+	return json.Unmarshal(data, (*restartPolicy)(policy))
+}
+
+func (policy *RestartPolicy) merge(other *RestartPolicy) {
+	if other.Policy != "" {
+		policy.Policy = other.Policy
+	}
+	if other.MaxRetries != 0 {
+		policy.MaxRetries = other.MaxRetries
+	}
+	if other.Backoff != "" {
+		policy.Backoff = other.Backoff
+	}
+	if other.MaxBackoff != "" {
+		policy.MaxBackoff = other.MaxBackoff
+	}
+}
+
+// check validates the policy
+func (policy *RestartPolicy) check() error {
+	_, _, err := policy.properties()
+	return err
+}
+
+// properties translates the policy into systemd properties,
+// separated into the ones of the [Unit] and the [Service] section
+func (policy *RestartPolicy) properties() (unit []string, service []string, err error) {
+	name := policy.Policy
+	switch name {
+	case "":
+		name = "on-failure"
+	case "no":
+		if policy.MaxRetries != 0 || policy.Backoff != "" || policy.MaxBackoff != "" {
+			return nil, nil, fmt.Errorf("maxRetries, backoff and maxBackoff need the restart policy on-failure or always")
+		}
+		return nil, []string{"Restart=no"}, nil
+	case "on-failure", "always":
+	default:
+		return nil, nil, fmt.Errorf("unknown restart policy %q (must be no, on-failure or always)", policy.Policy)
+	}
+	if policy.MaxRetries < 0 {
+		return nil, nil, fmt.Errorf("maxRetries must not be negative")
+	}
+	backoff := time.Second
+	if policy.Backoff != "" {
+		if backoff, err = time.ParseDuration(policy.Backoff); err != nil || backoff <= 0 {
+			return nil, nil, fmt.Errorf("invalid backoff %q", policy.Backoff)
+		}
+	}
+	service = []string{
+		"Restart=" + name,
+		fmt.Sprintf("RestartSec=%dms", backoff/time.Millisecond),
+	}
+	if policy.MaxBackoff != "" {
+		maxBackoff, err := time.ParseDuration(policy.MaxBackoff)
+		if err != nil || maxBackoff < backoff {
+			return nil, nil, fmt.Errorf("invalid maxBackoff %q, it must be a duration not smaller than the backoff", policy.MaxBackoff)
+		}
+		// systemd interpolates the delay exponentially in the given steps,
+		// choose them so that it doubles with every restart. Older systemd
+		// versions reject these properties, so they are only set if needed.
+		steps := int(math.Ceil(math.Log2(float64(maxBackoff) / float64(backoff))))
+		if steps > 0 {
+			service = append(service,
+				fmt.Sprintf("RestartSteps=%d", steps),
+				fmt.Sprintf("RestartMaxDelaySec=%dms", maxBackoff/time.Millisecond),
+			)
+		}
+	}
+	if policy.MaxRetries > 0 {
+		// the restarts are counted until the unit gets reset
+		unit = []string{
+			"StartLimitIntervalSec=infinity",
+			fmt.Sprintf("StartLimitBurst=%d", policy.MaxRetries+1),
+		}
+	}
+	return unit, service, nil
+}
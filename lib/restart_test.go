@@ -0,0 +1,37 @@
+package lib
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRestartPolicyProperties(t *testing.T) {
+	tests := []struct {
+		policy        RestartPolicy
+		unit, service string
+		expectedErr   string
+	}{
+		{RestartPolicy{Policy: "no"}, "", "Restart=no", ""},
+		{RestartPolicy{Policy: "always"}, "", "Restart=always RestartSec=1000ms", ""},
+		{RestartPolicy{MaxRetries: 3}, "StartLimitIntervalSec=infinity StartLimitBurst=4", "Restart=on-failure RestartSec=1000ms", ""},
+		{RestartPolicy{Policy: "on-failure", Backoff: "1s", MaxBackoff: "1m"}, "", "Restart=on-failure RestartSec=1000ms RestartSteps=6 RestartMaxDelaySec=60000ms", ""},
+		{RestartPolicy{Backoff: "5s"}, "", "Restart=on-failure RestartSec=5000ms", ""},
+		{RestartPolicy{Backoff: "5s", MaxBackoff: "5s"}, "", "Restart=on-failure RestartSec=5000ms", ""},
+		{RestartPolicy{Policy: "no", MaxRetries: 3}, "", "", "maxRetries, backoff and maxBackoff need the restart policy on-failure or always"},
+		{RestartPolicy{Policy: "sometimes"}, "", "", `unknown restart policy "sometimes"`},
+		{RestartPolicy{Backoff: "2s", MaxBackoff: "1s"}, "", "", `invalid maxBackoff "1s"`},
+	}
+	for _, test := range tests {
+		unit, service, err := test.policy.properties()
+		switch {
+		case test.expectedErr != "":
+			if err == nil || !strings.HasPrefix(err.Error(), test.expectedErr) {
+				t.Errorf("%+v: expected error %q, got %v", test.policy, test.expectedErr, err)
+			}
+		case err != nil:
+			t.Errorf("%+v: unexpected error %v", test.policy, err)
+		case strings.Join(unit, " ") != test.unit || strings.Join(service, " ") != test.service:
+			t.Errorf("%+v: expected %q and %q, got %q and %q", test.policy, test.unit, test.service, unit, service)
+		}
+	}
+}
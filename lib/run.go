@@ -1,30 +1,39 @@
 package lib
 
 import (
-	"fmt"
+	"io/ioutil"
 	"log"
-	"os"
-	"os/exec"
+	"strings"
 )
 
-func Run(podManifest, networks string, interactive, verbose bool, extra []string) error {
-	args := createRunArgList(podManifest, networks, interactive, verbose, extra)
-	cmd := exec.Command("rkt", args...)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	cmd.Stdin = os.Stdin
-	log.Print("starting pod...")
-	return cmd.Run()
-}
+// PodUUIDFile is the name of the file the uuid of a running pod is saved to
+const PodUUIDFile = ".pod-uuid"
 
-func createRunArgList(podManifest, networks string, interactive, verbose bool, extra []string) []string {
-	pwd, err := os.Getwd()
+// readPodUUID returns the uuid of the pod saved in uuidFile
+func readPodUUID(uuidFile string) (string, error) {
+	bs, err := ioutil.ReadFile(uuidFile)
 	if err != nil {
-		log.Fatal(err)
+		return "", newError(ErrPodNotRunning, "can not open pod uuid file: %v", err)
+	}
+	return strings.TrimSpace(string(bs)), nil
+}
+
+func Run(runner Runner, podManifest, uuidFile string, networks []*Network, interactive, verbose bool, extra []string) error {
+	if err := CheckDefaultRoutes(networks, NetworkConfigDir); err != nil {
+		return err
 	}
-	uuidSaveFile := fmt.Sprintf("--uuid-file-save=%v/.pod-uuid", pwd)
-	manifest := fmt.Sprintf("--pod-manifest=%v/%v", pwd, podManifest)
-	parts := []string{"run", manifest, "--net=" + networks, uuidSaveFile}
+	args := createRunArgList(podManifest, uuidFile, networks, interactive, verbose, extra)
+	log.Print("starting pod...")
+	return runAttached(runner, "rkt", args...)
+}
+
+// createRunArgList builds the arguments for rkt run.
+// podManifest and uuidFile should be absolute paths, as the pod may be
+// started from another working directory.
+func createRunArgList(podManifest, uuidFile string, networks []*Network, interactive, verbose bool, extra []string) []string {
+	uuidSaveFile := "--uuid-file-save=" + uuidFile
+	manifest := "--pod-manifest=" + podManifest
+	parts := []string{"run", manifest, netArg(networks), uuidSaveFile}
 	if interactive {
 		parts = append(parts, "--interactive")
 	}
@@ -0,0 +1,39 @@
+package lib
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCreateRunArgList(t *testing.T) {
+	cases := []struct {
+		name        string
+		interactive bool
+		verbose     bool
+		extra       []string
+		expected    []string
+	}{
+		{
+			name:     "plain",
+			expected: []string{"run", "--pod-manifest=/pod/manifest.json", "--net=default", "--uuid-file-save=/pod/.pod-uuid"},
+		},
+		{
+			name:        "interactive and verbose",
+			interactive: true,
+			verbose:     true,
+			expected:    []string{"run", "--pod-manifest=/pod/manifest.json", "--net=default", "--uuid-file-save=/pod/.pod-uuid", "--interactive", "--debug"},
+		},
+		{
+			name:     "extra args come last",
+			verbose:  true,
+			extra:    []string{"--dns=8.8.8.8"},
+			expected: []string{"run", "--pod-manifest=/pod/manifest.json", "--net=default", "--uuid-file-save=/pod/.pod-uuid", "--debug", "--dns=8.8.8.8"},
+		},
+	}
+	for _, c := range cases {
+		args := createRunArgList("/pod/manifest.json", "/pod/.pod-uuid", []*Network{{Name: "default"}}, c.interactive, c.verbose, c.extra)
+		if !reflect.DeepEqual(args, c.expected) {
+			t.Errorf("%v: expected %q, got %q", c.name, c.expected, args)
+		}
+	}
+}
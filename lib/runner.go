@@ -0,0 +1,149 @@
+package lib
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// Command is an external program to run, like rkt or systemctl
+type Command struct {
+	Name   string
+	Args   []string
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+	// Query marks commands which only read state, a DryRunner still runs them
+	Query bool
+}
+
+// String returns the command line, quoting arguments where needed
+func (cmd *Command) String() string {
+	parts := []string{cmd.Name}
+	for _, arg := range cmd.Args {
+		if arg == "" || strings.ContainsAny(arg, " \t\n\"'\\$;&|<>*?()") {
+			arg = strconv.Quote(arg)
+		}
+		parts = append(parts, arg)
+	}
+	return strings.Join(parts, " ")
+}
+
+// Runner runs external commands.
+// All calls to rkt, systemd and journalctl go through the runner passed to
+// the library, so they can be replaced, e.g. by a fake in tests.
+type Runner interface {
+	// Run runs cmd and waits for it to finish. A command which ran but
+	// failed is reported as *ExitError.
+	Run(ctx context.Context, cmd *Command) error
+}
+
+// ExitError is returned by a Runner if a command exited with a non zero code
+type ExitError struct {
+	// Code is the exit code, or 128 plus the signal number if the command
+	// was killed by a signal
+	Code int
+	Err  error
+}
+
+func (err *ExitError) Error() string {
+	return err.Err.Error()
+}
+
+// ExecRunner runs commands using os/exec
+type ExecRunner struct{}
+
+// Run implements Runner
+func (ExecRunner) Run(ctx context.Context, cmd *Command) error {
+	c := exec.CommandContext(ctx, cmd.Name, cmd.Args...)
+	c.Stdin = cmd.Stdin
+	c.Stdout = cmd.Stdout
+	c.Stderr = cmd.Stderr
+	err := c.Run()
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok {
+			code := status.ExitStatus()
+			if status.Signaled() {
+				code = 128 + int(status.Signal())
+			}
+			return &ExitError{Code: code, Err: err}
+		}
+	}
+	return err
+}
+
+// DryRunner logs the commands it is asked to run instead of running them.
+// Queries are passed on to Runner, so that decisions based on the state of
+// the host stay accurate.
+// Passing a DryRunner to the library puts it into dry-run mode, which means
+// that no files are written either.
+type DryRunner struct {
+	Runner Runner
+}
+
+// Run implements Runner
+func (runner *DryRunner) Run(ctx context.Context, cmd *Command) error {
+	if cmd.Query {
+		return runner.Runner.Run(ctx, cmd)
+	}
+	log.Printf("dry-run: would run %v", cmd)
+	return nil
+}
+
+// dryRun reports whether runner puts the library into dry-run mode
+func dryRun(runner Runner) bool {
+	_, ok := runner.(*DryRunner)
+	return ok
+}
+
+// attachedCommand returns a command connected to the standard streams of
+// rkt-compose
+func attachedCommand(name string, args ...string) *Command {
+	return &Command{
+		Name:   name,
+		Args:   args,
+		Stdin:  os.Stdin,
+		Stdout: os.Stdout,
+		Stderr: os.Stderr,
+	}
+}
+
+// run runs cmd using runner, failures are reported as ErrCommandFailed
+func run(runner Runner, cmd *Command) error {
+	return wrapError(ErrCommandFailed, runner.Run(context.Background(), cmd))
+}
+
+// runAttached runs a command connected to the standard streams of rkt-compose
+func runAttached(runner Runner, name string, args ...string) error {
+	return run(runner, attachedCommand(name, args...))
+}
+
+// runOutput runs a command and returns what it wrote to stdout.
+// On failure the last line written to stderr is added to the error, which
+// is reported as ErrCommandFailed.
+func runOutput(runner Runner, name string, args ...string) (string, error) {
+	return runCaptured(runner, &Command{Name: name, Args: args})
+}
+
+// runQuery is like runOutput, but for commands which only read state
+func runQuery(runner Runner, name string, args ...string) (string, error) {
+	return runCaptured(runner, &Command{Name: name, Args: args, Query: true})
+}
+
+func runCaptured(runner Runner, cmd *Command) (string, error) {
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	cmd.Stdout, cmd.Stderr = stdout, stderr
+	if err := runner.Run(context.Background(), cmd); err != nil {
+		if msg := lastLine(stderr.String()); msg != "" {
+			return stdout.String(), newError(ErrCommandFailed, "%v: %w: %v", cmd, err, msg)
+		}
+		return stdout.String(), newError(ErrCommandFailed, "%v: %w", cmd, err)
+	}
+	return stdout.String(), nil
+}
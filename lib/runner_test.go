@@ -0,0 +1,94 @@
+package lib
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeRunner records all commands and answers them using respond
+type fakeRunner struct {
+	mutex   sync.Mutex
+	calls   []string
+	respond func(cmd *Command) error
+}
+
+func (runner *fakeRunner) Run(ctx context.Context, cmd *Command) error {
+	runner.mutex.Lock()
+	runner.calls = append(runner.calls, cmd.String())
+	runner.mutex.Unlock()
+	if runner.respond == nil {
+		return nil
+	}
+	return runner.respond(cmd)
+}
+
+func (runner *fakeRunner) Calls() []string {
+	runner.mutex.Lock()
+	defer runner.mutex.Unlock()
+	return append([]string{}, runner.calls...)
+}
+
+func newFakeRunner(respond func(cmd *Command) error) *fakeRunner {
+	return &fakeRunner{respond: respond}
+}
+
+func exitStatus(code int) error {
+	return &ExitError{Code: code, Err: fmt.Errorf("exit status %v", code)}
+}
+
+func TestExecRunnerExitCode(t *testing.T) {
+	stdout := &strings.Builder{}
+	err := ExecRunner{}.Run(context.Background(), &Command{
+		Name:   "sh",
+		Args:   []string{"-c", "echo hello; exit 3"},
+		Stdout: stdout,
+	})
+	exitErr, ok := err.(*ExitError)
+	if !ok {
+		t.Fatalf("expected an *ExitError, got %#v", err)
+	}
+	if exitErr.Code != 3 {
+		t.Errorf("expected exit code 3, got %v", exitErr.Code)
+	}
+	if stdout.String() != "hello\n" {
+		t.Errorf("unexpected output %q", stdout.String())
+	}
+}
+
+func TestRunOutputAddsStderr(t *testing.T) {
+	runner := newFakeRunner(func(cmd *Command) error {
+		fmt.Fprintln(cmd.Stderr, "some progress")
+		fmt.Fprintln(cmd.Stderr, "error: no such pod")
+		return exitStatus(254)
+	})
+	_, err := runOutput(runner, "rkt", "status", "1234")
+	expected := "rkt status 1234: exit status 254: error: no such pod"
+	if err == nil || err.Error() != expected {
+		t.Errorf("expected error %q, got %v", expected, err)
+	}
+}
+
+func TestDryRunner(t *testing.T) {
+	runner := newFakeRunner(func(cmd *Command) error {
+		fmt.Fprint(cmd.Stdout, "ActiveState=active\n")
+		return nil
+	})
+	if err := Stop(&DryRunner{Runner: runner}, "test"); err != nil {
+		t.Fatal(err)
+	}
+	calls := runner.Calls()
+	if len(calls) != 1 || !strings.HasPrefix(calls[0], "systemctl show test.service") {
+		t.Errorf("expected only the query to run, got %q", calls)
+	}
+}
+
+func TestCommandString(t *testing.T) {
+	cmd := &Command{Name: "rkt", Args: []string{"run", "--hosts-entry=127.0.0.1=gitlab", "--set-env=MSG=hello world", ""}}
+	expected := `rkt run --hosts-entry=127.0.0.1=gitlab "--set-env=MSG=hello world" ""`
+	if cmd.String() != expected {
+		t.Errorf("expected %v, got %v", expected, cmd.String())
+	}
+}
@@ -0,0 +1,314 @@
+package lib
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/appc/spec/schema"
+	"github.com/appc/spec/schema/types"
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// DefaultSecretsDir is the directory secret files are written to, below a
+// directory per pod. It should be on a tmpfs, so that secrets never hit the
+// disk.
+const DefaultSecretsDir = "/run/rkt-compose"
+
+// secretsMountPath is the directory apps find their secret files in
+const secretsMountPath = "/run/secrets"
+
+// A Secret is a credential kept out of the compose file.
+// Exactly one of File, Env and Command has to be given.
+type Secret struct {
+	Name string `json:"name" yaml:"name,omitempty"`
+	// File is read for the value, relative to the project directory
+	File string `json:"file,omitempty" yaml:"file,omitempty"`
+	// Env is the variable holding the value, it is looked up in the
+	// environment and in the .env file of the project
+	Env string `json:"env,omitempty" yaml:"env,omitempty"`
+	// Command prints the value, e.g. [pass, show, db]
+	Command []string `json:"command,omitempty" yaml:"command,omitempty"`
+}
+
+// An AppSecret hands a secret to an app. By default it is mounted read-only
+// at /run/secrets/<name>.
+type AppSecret struct {
+	Name string `json:"name" yaml:"name,omitempty"`
+	// Env injects the secret as environment variable instead. Note that the
+	// value then ends up in the pod manifest.
+	Env string `json:"env,omitempty" yaml:"env,omitempty"`
+}
+
+func (secret *Secret) merge(other *Secret) {
+	if other.File != "" || other.Env != "" || len(other.Command) > 0 {
+		secret.File, secret.Env, secret.Command = other.File, other.Env, other.Command
+	}
+}
+
+// check validates the secret
+func (secret *Secret) check() error {
+	sources := 0
+	for _, set := range []bool{secret.File != "", secret.Env != "", len(secret.Command) > 0} {
+		if set {
+			sources++
+		}
+	}
+	if sources != 1 {
+		return fmt.Errorf("exactly one of file, env and command must be specified")
+	}
+	return nil
+}
+
+func (composeFile *ComposeFile) secret(name string) *Secret {
+	for _, secret := range composeFile.Secrets {
+		if secret.Name == name {
+			return secret
+		}
+	}
+	return nil
+}
+
+// checkSecrets reports problems with the secrets and their use by apps
+func (composeFile *ComposeFile) checkSecrets(report func(path, format string, args ...interface{})) {
+	for _, secret := range composeFile.Secrets {
+		path := fmt.Sprintf("secrets[%v]", secret.Name)
+		if _, err := types.NewACName(secret.Name); err != nil {
+			report(path+".name", "invalid secret name %q: %v", secret.Name, err)
+		}
+		if err := secret.check(); err != nil {
+			report(path, "%v", err)
+		}
+	}
+	for _, app := range composeFile.Manifest.Apps {
+		for idx, secret := range app.Secrets {
+			if composeFile.secret(secret.Name) == nil {
+				report(fmt.Sprintf("manifest.apps[%v].secrets[%v]", app.Name, idx), "unknown secret %v", secret.Name)
+			}
+		}
+	}
+}
+
+// resolveSecrets reads the values of all secrets used by apps
+func (composeFile *ComposeFile) resolveSecrets(runner Runner) (map[string]string, error) {
+	values := map[string]string{}
+	var dotEnv map[string]string
+	for _, app := range composeFile.Manifest.Apps {
+		for _, use := range app.Secrets {
+			if _, ok := values[use.Name]; ok {
+				continue
+			}
+			secret := composeFile.secret(use.Name)
+			var value string
+			var err error
+			switch {
+			case secret.File != "":
+				var bs []byte
+				bs, err = ioutil.ReadFile(composeFile.ProjectPath(secret.File))
+				value = string(bs)
+			case secret.Env != "":
+				var ok bool
+				if value, ok = os.LookupEnv(secret.Env); !ok {
+					if dotEnv == nil {
+						if dotEnv, err = loadDotEnv(composeFile.ProjectPath(".env")); err != nil {
+							break
+						}
+					}
+					if value, ok = dotEnv[secret.Env]; !ok {
+						err = fmt.Errorf("variable %v is not set", secret.Env)
+					}
+				}
+			default:
+				value, err = runSecretCommand(runner, secret.Command)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("secret %v: %v", secret.Name, err)
+			}
+			values[use.Name] = strings.TrimSuffix(value, "\n")
+		}
+	}
+	return values, nil
+}
+
+// runSecretCommand runs command and returns its output. It is connected to
+// the terminal, so that e.g. gpg can ask for a passphrase.
+func runSecretCommand(runner Runner, command []string) (string, error) {
+	stdout := &bytes.Buffer{}
+	cmd := &Command{
+		Name:   command[0],
+		Args:   command[1:],
+		Stdin:  os.Stdin,
+		Stdout: stdout,
+		Stderr: os.Stderr,
+		Query:  true,
+	}
+	if err := runner.Run(context.Background(), cmd); err != nil {
+		return "", newError(ErrCommandFailed, "%v: %w", cmd, err)
+	}
+	return stdout.String(), nil
+}
+
+// appSecretsDir returns the directory the secret files of app are written to
+func (composeFile *ComposeFile) appSecretsDir(base string, app types.ACName) string {
+	if base == "" {
+		base = DefaultSecretsDir
+	}
+	return filepath.Join(base, composeFile.Name, "secrets", app.String())
+}
+
+// secretFilesMissing reports whether a secret file of any app is missing,
+// e.g. because the tmpfs was cleared by a reboot
+func (composeFile *ComposeFile) secretFilesMissing(base string) bool {
+	for _, app := range composeFile.Manifest.Apps {
+		for _, secret := range app.Secrets {
+			if secret.Env != "" {
+				continue
+			}
+			if _, err := os.Stat(filepath.Join(composeFile.appSecretsDir(base, app.Name), secret.Name)); err != nil {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// writeSecrets writes the secret files of all apps below base. The pod
+// directory is only accessible by root, the files inside are readable for
+// everyone, as apps may run as any user.
+func (composeFile *ComposeFile) writeSecrets(runner Runner, base string, values map[string]string) error {
+	for _, app := range composeFile.Manifest.Apps {
+		files := []*AppSecret{}
+		for _, secret := range app.Secrets {
+			if secret.Env == "" {
+				files = append(files, secret)
+			}
+		}
+		if len(files) == 0 {
+			continue
+		}
+		dir := composeFile.appSecretsDir(base, app.Name)
+		if dryRun(runner) {
+			log.Printf("dry-run: would write %v secret file(s) to %v", len(files), dir)
+			continue
+		}
+		podDir := filepath.Dir(filepath.Dir(dir))
+		if err := os.MkdirAll(podDir, 0700); err != nil {
+			return err
+		}
+		if err := os.Chmod(podDir, 0700); err != nil {
+			return err
+		}
+		if !onTmpfs(podDir) {
+			log.Printf("warning: %v is not on a tmpfs, secrets get written to disk", podDir)
+		}
+		// drop secrets which are no longer used
+		if err := os.RemoveAll(dir); err != nil {
+			return err
+		}
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+		for _, secret := range files {
+			if err := ioutil.WriteFile(filepath.Join(dir, secret.Name), []byte(values[secret.Name]), 0444); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// onTmpfs reports whether path is on a tmpfs
+func onTmpfs(path string) bool {
+	const tmpfsMagic = 0x01021994
+	stat := &syscall.Statfs_t{}
+	return syscall.Statfs(path, stat) == nil && stat.Type == tmpfsMagic
+}
+
+// commandSecret returns the name of a secret used by an app whose value is
+// printed by a command, if any
+func (composeFile *ComposeFile) commandSecret() string {
+	for _, app := range composeFile.Manifest.Apps {
+		for _, use := range app.Secrets {
+			if secret := composeFile.secret(use.Name); secret != nil && len(secret.Command) > 0 {
+				return use.Name
+			}
+		}
+	}
+	return ""
+}
+
+// applySecrets hands the secrets to the apps of the appc manifest: secret
+// files are mounted as read-only volume, the others are injected into the
+// environment
+func (composeFile *ComposeFile) applySecrets(manifest *schema.PodManifest, base string, values map[string]string) {
+	for idx, app := range composeFile.Manifest.Apps {
+		runtimeApp := &manifest.Apps[idx]
+		hasFiles := false
+		for _, secret := range app.Secrets {
+			if secret.Env != "" {
+				runtimeApp.App.Environment.Set(secret.Env, values[secret.Name])
+			} else {
+				hasFiles = true
+			}
+		}
+		if !hasFiles {
+			continue
+		}
+		name := types.ACName("secrets-" + app.Name.String())
+		readOnly := true
+		manifest.Volumes = append(manifest.Volumes, types.Volume{
+			Name:     name,
+			Kind:     "host",
+			Source:   composeFile.appSecretsDir(base, app.Name),
+			ReadOnly: &readOnly,
+		})
+		runtimeApp.Mounts = append(runtimeApp.Mounts, schema.Mount{Volume: name, Path: secretsMountPath})
+	}
+}
+
+// secretNameParts are parts of variable names which hint at credentials
+var secretNameParts = []string{"PASS", "SECRET", "TOKEN", "CREDENTIAL", "PRIVATE_KEY", "API_KEY", "ACCESS_KEY"}
+
+// lintSecrets warns about environment variables of apps which look like
+// credentials but are given as literal values. It runs before variables are
+// substituted, values taken from variables are fine.
+func lintSecrets(doc *yamlv3.Node) ValidationErrors {
+	warnings := ValidationErrors{}
+	apps := lookupNode(doc, "manifest.apps")
+	if apps == nil || apps.Kind != yamlv3.SequenceNode {
+		return warnings
+	}
+	for idx, app := range apps.Content {
+		appName := fmt.Sprint(idx)
+		if name := mappingValue(app, "name"); name != nil {
+			appName = name.Value
+		}
+		env := lookupNode(app, "app.environment")
+		if env == nil || env.Kind != yamlv3.SequenceNode {
+			continue
+		}
+		for _, entry := range env.Content {
+			name, value := mappingValue(entry, "name"), mappingValue(entry, "value")
+			if name == nil || value == nil || value.Value == "" || strings.Contains(value.Value, "$") {
+				continue
+			}
+			for _, part := range secretNameParts {
+				if strings.Contains(strings.ToUpper(name.Value), part) {
+					warnings = append(warnings, &ValidationError{
+						Line:    value.Line,
+						Path:    fmt.Sprintf("manifest.apps[%v].app.environment[%v]", appName, name.Value),
+						Message: "looks like a secret given as literal value, use a secret or a variable instead",
+					})
+					break
+				}
+			}
+		}
+	}
+	return warnings
+}
@@ -0,0 +1,232 @@
+package lib
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/appc/spec/schema"
+)
+
+const testSecretsYAML = `
+name: test
+secrets:
+  - name: db-pass
+    file: ./db-pass
+  - name: api-token
+    env: TEST_API_TOKEN
+  - name: tls-key
+    command: [pass, show, tls]
+manifest:
+  apps:
+    - name: web
+      image:
+        id: sha512-0123456789abcdef0123456789abcdef
+      app:
+        exec: [web]
+        environment:
+          - name: ADMIN_PASSWORD
+            value: hunter2
+          - name: DB_PASSWORD
+            value: ${DB_PASSWORD:-}
+      secrets:
+        - name: db-pass
+        - name: tls-key
+        - name: api-token
+          env: API_TOKEN
+`
+
+func TestPrepareWritesSecrets(t *testing.T) {
+	path, cleanup := writeComposeFile(t, testSecretsYAML)
+	defer cleanup()
+	dir := filepath.Dir(path)
+	ioutil.WriteFile(filepath.Join(dir, "db-pass"), []byte("secret\n"), 0600)
+	os.Setenv("TEST_API_TOKEN", "token")
+	defer os.Unsetenv("TEST_API_TOKEN")
+	runner := newFakeRunner(func(cmd *Command) error {
+		fmt.Fprintln(cmd.Stdout, "-----BEGIN KEY-----")
+		return nil
+	})
+
+	composeFile, err := NewComposeFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	warnings := composeFile.Warnings()
+	if len(warnings) != 1 || warnings[0].Line != 19 || warnings[0].Path != "manifest.apps[web].app.environment[ADMIN_PASSWORD]" {
+		t.Errorf("expected a warning about ADMIN_PASSWORD, got %v", warnings)
+	}
+
+	opts := PrepareOptions{Runner: runner, SecretsDir: filepath.Join(dir, "run")}
+	if needed, reason, _ := composeFile.PrepareNeeded(filepath.Join(dir, "manifest.json"), opts); !needed {
+		t.Errorf("expected prepare to be needed")
+	} else if reason != "no manifest found" {
+		t.Errorf("unexpected reason %q", reason)
+	}
+	output := &bytes.Buffer{}
+	if err := composeFile.Prepare(output, opts); err != nil {
+		t.Fatal(err)
+	}
+	if calls := runner.Calls(); len(calls) != 1 || calls[0] != "pass show tls" {
+		t.Errorf("unexpected calls %q", calls)
+	}
+
+	secretsDir := filepath.Join(dir, "run", "test", "secrets", "web")
+	for name, expected := range map[string]string{"db-pass": "secret", "tls-key": "-----BEGIN KEY-----"} {
+		bs, err := ioutil.ReadFile(filepath.Join(secretsDir, name))
+		if err != nil || string(bs) != expected {
+			t.Errorf("expected secret file %v to contain %q, got %q (%v)", name, expected, bs, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(secretsDir, "api-token")); !os.IsNotExist(err) {
+		t.Errorf("expected no file for the env secret, got %v", err)
+	}
+	if info, err := os.Stat(filepath.Join(dir, "run", "test")); err != nil || info.Mode().Perm() != 0700 {
+		t.Errorf("expected the pod secrets directory to be private, got %v (%v)", info.Mode(), err)
+	}
+
+	manifest := &schema.PodManifest{}
+	if err := json.Unmarshal(output.Bytes(), manifest); err != nil {
+		t.Fatal(err)
+	}
+	app := manifest.Apps[0]
+	if value, _ := app.App.Environment.Get("API_TOKEN"); value != "token" {
+		t.Errorf("expected API_TOKEN to be injected, got %q", value)
+	}
+	if strings.Contains(output.String(), "secret\"") || strings.Contains(output.String(), "BEGIN KEY") {
+		t.Errorf("expected secret files to stay out of the manifest")
+	}
+	if len(app.Mounts) != 1 || app.Mounts[0].Path != "/run/secrets" || app.Mounts[0].Volume != "secrets-web" {
+		t.Errorf("expected the secrets volume to be mounted, got %v", app.Mounts)
+	}
+	volume := manifest.Volumes[len(manifest.Volumes)-1]
+	if volume.Source != secretsDir || volume.ReadOnly == nil || !*volume.ReadOnly {
+		t.Errorf("expected a read-only volume for %v, got %+v", secretsDir, volume)
+	}
+}
+
+func TestPrepareNeededSecrets(t *testing.T) {
+	path, cleanup := writeComposeFile(t, `
+name: test
+secrets:
+  - name: db-pass
+    env: DB_PASS
+manifest:
+  apps:
+    - name: web
+      image:
+        id: sha512-0123456789abcdef0123456789abcdef
+      app:
+        exec: [web]
+      secrets:
+        - name: db-pass
+          env: DB_PASSWORD
+`)
+	defer cleanup()
+	dir := filepath.Dir(path)
+	manifestPath := filepath.Join(dir, "manifest.json")
+	opts := PrepareOptions{Runner: newFakeRunner(nil), SecretsDir: filepath.Join(dir, "run")}
+	setPassword := func(value string) *ComposeFile {
+		if err := ioutil.WriteFile(filepath.Join(dir, ".env"), []byte("DB_PASS="+value+"\n"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		composeFile, err := NewComposeFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return composeFile
+	}
+
+	composeFile := setPassword("old")
+	output := &bytes.Buffer{}
+	if err := composeFile.Prepare(output, opts); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(manifestPath, output.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if needed, reason, _ := setPassword("old").PrepareNeeded(manifestPath, opts); needed {
+		t.Errorf("expected the manifest to be up to date, got %q", reason)
+	}
+	if needed, reason, _ := setPassword("new").PrepareNeeded(manifestPath, opts); !needed || reason != "inputs changed" {
+		t.Errorf("expected a rotated secret to outdate the manifest, got %v with %q", needed, reason)
+	}
+	os.Remove(filepath.Join(dir, ".env"))
+	composeFile, _ = NewComposeFile(path)
+	if needed, reason, _ := composeFile.PrepareNeeded(manifestPath, opts); !needed || reason != "secret db-pass: variable DB_PASS is not set" {
+		t.Errorf("expected a missing secret to outdate the manifest, got %v with %q", needed, reason)
+	}
+
+	composeFile.Secrets[0] = &Secret{Name: "db-pass", Command: []string{"pass", "show", "db"}}
+	if needed, reason, _ := composeFile.PrepareNeeded(manifestPath, opts); !needed || reason != "secret db-pass is printed by a command" {
+		t.Errorf("expected a secret printed by a command to outdate the manifest, got %v with %q", needed, reason)
+	}
+}
+
+func TestPrepareNeededFileSecret(t *testing.T) {
+	path, cleanup := writeComposeFile(t, `
+name: test
+secrets:
+  - name: db-pass
+    file: ./db-pass
+manifest:
+  apps:
+    - name: web
+      image:
+        id: sha512-0123456789abcdef0123456789abcdef
+      app:
+        exec: [web]
+      secrets:
+        - name: db-pass
+`)
+	defer cleanup()
+	dir := filepath.Dir(path)
+	manifestPath := filepath.Join(dir, "manifest.json")
+	opts := PrepareOptions{Runner: newFakeRunner(nil), SecretsDir: filepath.Join(dir, "run")}
+	composeFile, err := NewComposeFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "db-pass"), []byte("old\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	output := &bytes.Buffer{}
+	if err := composeFile.Prepare(output, opts); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(manifestPath, output.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if needed, reason, _ := composeFile.PrepareNeeded(manifestPath, opts); needed {
+		t.Errorf("expected the manifest to be up to date, got %q", reason)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "db-pass"), []byte("new\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if needed, reason, _ := composeFile.PrepareNeeded(manifestPath, opts); !needed || reason != "inputs changed" {
+		t.Errorf("expected a rotated secret file to outdate the secret files, got %v with %q", needed, reason)
+	}
+}
+
+func TestSecretsValidation(t *testing.T) {
+	content := strings.Replace(testSecretsYAML, "    command: [pass, show, tls]", "    command: [pass, show, tls]\n    env: TLS_KEY", 1)
+	content = strings.Replace(content, "        - name: tls-key", "        - name: missing", 1)
+	path, cleanup := writeComposeFile(t, content)
+	defer cleanup()
+	_, err := NewComposeFile(path)
+	errs, ok := err.(ValidationErrors)
+	if !ok || len(errs) != 2 {
+		t.Fatalf("expected two problems, got %v", err)
+	}
+	if !strings.HasSuffix(errs[0].Error(), "secrets[tls-key]: exactly one of file, env and command must be specified") {
+		t.Errorf("unexpected error %v", errs[0])
+	}
+	if !strings.HasSuffix(errs[1].Error(), "manifest.apps[web].secrets[1]: unknown secret missing") {
+		t.Errorf("unexpected error %v", errs[1])
+	}
+}
@@ -0,0 +1,159 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/appc/spec/schema/types"
+)
+
+// Stage1ImagesDirs are searched for the images of stage1 flavors, next to
+// the directory of the rkt binary
+var Stage1ImagesDirs = []string{"/usr/lib/rkt/stage1-images", "/usr/lib64/rkt/stage1-images"}
+
+// stage1Flavors are the flavors rkt is built with
+var stage1Flavors = map[string]bool{"coreos": true, "kvm": true, "fly": true, "src": true, "host": true}
+
+// stage1Kind tells how the stage1 of the compose file is given: as flavor,
+// url, hash, path or image name
+func (composeFile *ComposeFile) stage1Kind() string {
+	stage1 := composeFile.Stage1
+	switch {
+	case stage1 == "":
+		return ""
+	case stage1Flavors[stage1]:
+		return "flavor"
+	case strings.Contains(stage1, "://"):
+		return "url"
+	case strings.HasPrefix(stage1, "sha512-"):
+		return "hash"
+	case strings.HasPrefix(stage1, "/") || strings.HasPrefix(stage1, ".") || strings.HasSuffix(stage1, ".aci"):
+		return "path"
+	}
+	return "name"
+}
+
+// stage1Args renders the stage1 as flag of rkt run
+func (composeFile *ComposeFile) stage1Args() []string {
+	switch composeFile.stage1Kind() {
+	case "flavor":
+		return []string{fmt.Sprintf("--stage1-from-dir=stage1-%v.aci", composeFile.Stage1)}
+	case "url":
+		return []string{"--stage1-url=" + composeFile.Stage1}
+	case "hash":
+		return []string{"--stage1-hash=" + composeFile.Stage1}
+	case "path":
+		return []string{"--stage1-path=" + composeFile.ProjectPath(composeFile.Stage1)}
+	case "name":
+		return []string{"--stage1-name=" + composeFile.Stage1}
+	}
+	return []string{}
+}
+
+// isFly reports whether the pod runs with stage1-fly, which runs the apps
+// in the namespaces of the host
+func (composeFile *ComposeFile) isFly() bool {
+	return composeFile.Stage1 == "fly" || strings.Contains(composeFile.Stage1, "stage1-fly")
+}
+
+// checkStage1 reports invalid stage1 images
+func (composeFile *ComposeFile) checkStage1(report func(path, format string, args ...interface{})) {
+	switch composeFile.stage1Kind() {
+	case "hash":
+		hex := strings.TrimPrefix(composeFile.Stage1, "sha512-")
+		if hex == "" || strings.Trim(hex, "0123456789abcdef") != "" {
+			report("stage1", "invalid image hash %q", composeFile.Stage1)
+		}
+	case "name":
+		name := strings.SplitN(composeFile.Stage1, ":", 2)[0]
+		if _, err := types.NewACIdentifier(name); err != nil {
+			report("stage1", "invalid stage1 %q, expected a flavor (coreos, kvm, fly, ...), an image name, a path, an url or a hash", composeFile.Stage1)
+		}
+	}
+}
+
+// assertStage1 checks that the stage1 image is available before the pod is
+// started: images of flavors have to exist in one of Stage1ImagesDirs,
+// images given by name or hash in the store of rkt. Urls are not checked.
+func (composeFile *ComposeFile) assertStage1(runner Runner) error {
+	stage1 := composeFile.Stage1
+	switch composeFile.stage1Kind() {
+	case "flavor":
+		dirs := append([]string{}, Stage1ImagesDirs...)
+		dirs = append(dirs, filepath.Dir(lookPath("rkt")))
+		for _, dir := range dirs {
+			if _, err := os.Stat(filepath.Join(dir, "stage1-"+stage1+".aci")); err == nil {
+				return nil
+			}
+		}
+		return newError(ErrImageFetch, "stage1 flavor %v is not installed, stage1-%v.aci is missing in %v", stage1, stage1, strings.Join(dirs, ", "))
+	case "path":
+		if _, err := os.Stat(composeFile.ProjectPath(stage1)); err != nil {
+			return newError(ErrImageFetch, "stage1 image not found: %v", err)
+		}
+	case "hash":
+		if _, err := runQuery(runner, "rkt", "image", "cat-manifest", stage1); err != nil {
+			return newError(ErrImageFetch, "stage1 image %v is not in the store: %w", stage1, err)
+		}
+	case "name":
+		images := []struct {
+			Name string `json:"name"`
+		}{}
+		stdout, err := runQuery(runner, "rkt", "image", "list", "--format=json")
+		if err != nil {
+			return err
+		}
+		if err := json.Unmarshal([]byte(stdout), &images); err != nil {
+			return fmt.Errorf("rkt image list: can not parse output: %v", err)
+		}
+		for _, image := range images {
+			if image.Name == stage1 || (!strings.Contains(stage1, ":") && strings.HasPrefix(image.Name, stage1+":")) {
+				return nil
+			}
+		}
+		return newError(ErrImageFetch, "stage1 image %v is not in the store, fetch it with rkt fetch", stage1)
+	}
+	return nil
+}
+
+// flyWarnings warns about fields which are ignored by stage1-fly
+func (composeFile *ComposeFile) flyWarnings() ValidationErrors {
+	warnings := ValidationErrors{}
+	if !composeFile.isFly() {
+		return warnings
+	}
+	warn := func(path, format string, args ...interface{}) {
+		warnings = append(warnings, composeFile.warning(path, format, args...))
+	}
+	if _, line := composeFile.locate("networks"); line > 0 {
+		warn("networks", "networks are ignored by stage1-fly, the pod uses the network of the host")
+	}
+	if len(composeFile.Manifest.Ports) > 0 {
+		warn("manifest.ports", "ports are not forwarded by stage1-fly, apps listen on the host directly")
+	}
+	if composeFile.CPU != "" {
+		warn("cpu", "cpu is ignored by stage1-fly")
+	}
+	if composeFile.Memory != "" {
+		warn("memory", "memory is ignored by stage1-fly")
+	}
+	if len(composeFile.Manifest.Isolators) > 0 {
+		warn("manifest.isolators", "isolators are ignored by stage1-fly")
+	}
+	for _, app := range composeFile.Manifest.Apps {
+		path := fmt.Sprintf("manifest.apps[%v]", app.Name)
+		if len(app.Publish) > 0 {
+			warn(path+".publish", "ports are not forwarded by stage1-fly, apps listen on the host directly")
+		}
+		if app.App == nil {
+			continue
+		}
+		if app.App.CPU != "" || app.App.CPURequest != "" || app.App.Memory != "" || app.App.MemoryRequest != "" || len(app.App.Isolators) > 0 {
+			warn(path+".app", "cpu, memory and isolators are ignored by stage1-fly")
+		}
+	}
+	return warnings
+}
@@ -0,0 +1,145 @@
+package lib
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestStage1Args(t *testing.T) {
+	tests := map[string]string{
+		"kvm":                              "--stage1-from-dir=stage1-kvm.aci",
+		"coreos.com/rkt/stage1-fly:1.30.0": "--stage1-name=coreos.com/rkt/stage1-fly:1.30.0",
+		"./stage1-custom.aci":              "--stage1-path=/project/stage1-custom.aci",
+		"/opt/stage1.aci":                  "--stage1-path=/opt/stage1.aci",
+		"https://example.com/stage1.aci":   "--stage1-url=https://example.com/stage1.aci",
+		"sha512-0123456789abcdef":          "--stage1-hash=sha512-0123456789abcdef",
+	}
+	for stage1, expected := range tests {
+		composeFile := &ComposeFile{Stage1: stage1, ProjectDirectory: "/project", Extra: []string{"--debug"}}
+		if args := composeFile.RunArgs(); !reflect.DeepEqual(args, []string{expected, "--debug"}) {
+			t.Errorf("%v: expected %v, got %q", stage1, expected, args)
+		}
+	}
+	if args := (&ComposeFile{}).RunArgs(); len(args) != 0 {
+		t.Errorf("expected the default stage1 to be used, got %q", args)
+	}
+}
+
+func TestAssertStage1(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rkt-compose-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(filepath.Join(dir, "stage1-kvm.aci"), nil, 0644)
+	defer func(dirs []string) { Stage1ImagesDirs = dirs }(Stage1ImagesDirs)
+	Stage1ImagesDirs = []string{dir}
+	runner := newFakeRunner(func(cmd *Command) error {
+		switch cmd.Args[1] {
+		case "list":
+			fmt.Fprintln(cmd.Stdout, `[{"id": "sha512-aa", "name": "coreos.com/rkt/stage1-kvm:1.30.0"}]`)
+		case "cat-manifest":
+			if cmd.Args[2] != "sha512-aa" {
+				return exitStatus(1)
+			}
+		}
+		return nil
+	})
+
+	tests := map[string]bool{
+		"kvm":                              true,
+		"fly":                              false,
+		"coreos.com/rkt/stage1-kvm":        true,
+		"coreos.com/rkt/stage1-kvm:1.30.0": true,
+		"coreos.com/rkt/stage1-kvm:1.29.0": false,
+		"sha512-aa":                        true,
+		"sha512-bb":                        false,
+		"stage1-kvm.aci":                   true,
+		"./missing.aci":                    false,
+		"https://example.com/stage1.aci":   true,
+	}
+	for stage1, available := range tests {
+		composeFile := &ComposeFile{Stage1: stage1, ProjectDirectory: dir}
+		err := composeFile.assertStage1(runner)
+		if (err == nil) != available || (err != nil && !errors.Is(err, ErrImageFetch)) {
+			t.Errorf("%v: expected available=%v, got %v", stage1, available, err)
+		}
+	}
+	calls := runner.Calls()
+	sort.Strings(calls)
+	expected := []string{
+		"rkt image cat-manifest sha512-aa", "rkt image cat-manifest sha512-bb",
+		"rkt image list --format=json", "rkt image list --format=json", "rkt image list --format=json",
+	}
+	if !reflect.DeepEqual(calls, expected) {
+		t.Errorf("unexpected calls %q", calls)
+	}
+}
+
+func TestPrepareNeededChecksStage1(t *testing.T) {
+	path, cleanup := writeComposeFile(t, testComposeYAML)
+	defer cleanup()
+	composeFile, err := NewComposeFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func(dirs []string) { Stage1ImagesDirs = dirs }(Stage1ImagesDirs)
+	Stage1ImagesDirs = []string{filepath.Dir(path)}
+	composeFile.Stage1 = "kvm"
+	_, _, err = composeFile.PrepareNeeded(filepath.Join(filepath.Dir(path), "manifest.json"), PrepareOptions{Runner: newFakeRunner(nil)})
+	if !errors.Is(err, ErrImageFetch) {
+		t.Errorf("expected the missing stage1 to be reported, got %v", err)
+	}
+}
+
+const testFlyYAML = `
+name: test
+stage1: fly
+networks: [backend]
+cpu: 500m
+extra: [--stage1-from-dir=stage1-coreos.aci]
+manifest:
+  apps:
+    - name: web
+      publish: ["8080:80"]
+      image:
+        name: web
+      app:
+        exec: [web]
+        memory: 128M
+    - name: db
+      image:
+        name: db
+`
+
+func TestFlyWarnings(t *testing.T) {
+	path, cleanup := writeComposeFile(t, testFlyYAML)
+	defer cleanup()
+	composeFile, err := NewComposeFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"4: networks: networks are ignored by stage1-fly, the pod uses the network of the host",
+		"5: cpu: cpu is ignored by stage1-fly",
+		"10: manifest.apps[web].publish: ports are not forwarded by stage1-fly, apps listen on the host directly",
+		"14: manifest.apps[web].app: cpu, memory and isolators are ignored by stage1-fly",
+		"6: extra[0]: --stage1-from-dir conflicts with stage1, remove it from extra",
+	}
+	warnings := composeFile.Warnings()
+	if len(warnings) != len(expected) {
+		t.Fatalf("expected %v warnings, got %v", len(expected), warnings)
+	}
+	for idx, warning := range warnings {
+		if !strings.HasSuffix(warning.Error(), "rkt-compose.yaml:"+expected[idx]) {
+			t.Errorf("expected %q, got %v", expected[idx], warning)
+		}
+	}
+}
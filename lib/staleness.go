@@ -0,0 +1,169 @@
+package lib
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+
+	"github.com/appc/spec/schema"
+	"github.com/appc/spec/schema/types"
+)
+
+// InputHashAnnotation is the pod annotation holding the hash of all inputs
+// a pod manifest was generated from
+const InputHashAnnotation = "rkt-compose/input-hash"
+
+// inputDigest captures the merged compose file, the project directory and
+// the variables used before any images are resolved
+func (composeFile *ComposeFile) inputDigest() ([]byte, error) {
+	bs, err := json.Marshal(composeFile)
+	if err != nil {
+		return nil, err
+	}
+	// relative paths get resolved against the project directory
+	bs = append(bs, "\nproject:"+composeFile.ProjectDirectory...)
+	vars := composeFile.Variables()
+	names := make([]string, 0, len(vars))
+	for name := range vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if value := vars[name]; value != nil {
+			bs = append(bs, fmt.Sprintf("\n%v=%v", name, *value)...)
+		} else {
+			bs = append(bs, fmt.Sprintf("\n%v unset", name)...)
+		}
+	}
+	return bs, nil
+}
+
+// inputHash combines the input digest with the lock file, the image ids and
+// the values of the secrets
+func inputHash(digest []byte, lockFile string, imageIDs []string, secrets map[string]string) string {
+	h := sha256.New()
+	h.Write(digest)
+	if lockFile != "" {
+		if bs, err := ioutil.ReadFile(lockFile); err == nil {
+			h.Write([]byte("\nlock:"))
+			h.Write(bs)
+		}
+	}
+	for _, id := range imageIDs {
+		h.Write([]byte("\nimage:" + id))
+	}
+	names := make([]string, 0, len(secrets))
+	for name := range secrets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		h.Write([]byte(fmt.Sprintf("\nsecret:%v=%q", name, secrets[name])))
+	}
+	return fmt.Sprintf("sha256-%x", h.Sum(nil))
+}
+
+// imageIDs returns the image ids of the apps once they are resolved
+func (composeFile *ComposeFile) imageIDs() []string {
+	ids := make([]string, len(composeFile.Manifest.Apps))
+	for idx, app := range composeFile.Manifest.Apps {
+		ids[idx] = app.Image.ID.String()
+	}
+	return ids
+}
+
+// storeImageIDs resolves the image ids of the apps like prepare does, but
+// without fetching: ids given in the compose file, then ids pinned by the
+// lock file and otherwise the image in the store matching name and labels.
+// An app whose image is not in the store is returned instead.
+func (composeFile *ComposeFile) storeImageIDs(opts PrepareOptions) ([]string, *RuntimeApp) {
+	lock := &LockFile{}
+	if opts.LockFile != "" && !opts.UpdateLock {
+		if locked, err := ReadLockFile(opts.LockFile); err == nil {
+			lock = locked
+		}
+	}
+	ids := make([]string, len(composeFile.Manifest.Apps))
+	resolved := map[string]string{}
+	for idx, app := range composeFile.Manifest.Apps {
+		url := app.Image.imageURL()
+		entry := lock.entry(app.Name)
+		switch {
+		case !app.Image.ID.Empty():
+			ids[idx] = app.Image.ID.String()
+		case entry != nil && entry.Image == url:
+			ids[idx] = entry.ID.String()
+		case resolved[url] != "":
+			ids[idx] = resolved[url]
+		default:
+			cmd := fetchCommand(url, "never")
+			cmd.Query = true
+			hash, _, err := runFetch(opts.Runner, cmd)
+			if err != nil {
+				return nil, app
+			}
+			ids[idx], resolved[url] = hash.String(), hash.String()
+		}
+	}
+	return ids, nil
+}
+
+// PrepareNeeded checks if the pod manifest at manifestPath is outdated.
+// It is, if it is missing, if one of its images vanished from the store, if
+// secret files are missing or if any input (compose files, variables, lock
+// file, image ids, values of secrets) changed.
+// Image ids are resolved from the store again, so a tag pointing to another
+// image is noticed. Secrets printed by commands are not run here, the
+// manifest and the secret files are always rewritten if one of them is used. The reason is returned for display purposes. A missing
+// stage1 image is an error, as the manifest does not depend on it.
+func (composeFile *ComposeFile) PrepareNeeded(manifestPath string, opts PrepareOptions) (bool, string, error) {
+	if err := composeFile.assertStage1(opts.Runner); err != nil {
+		return false, "", err
+	}
+	bs, err := ioutil.ReadFile(manifestPath)
+	if err != nil {
+		return true, "no manifest found", nil
+	}
+	manifest := &schema.PodManifest{}
+	if err := json.Unmarshal(bs, manifest); err != nil {
+		return true, "manifest is invalid", nil
+	}
+	hash, ok := manifest.Annotations.Get(InputHashAnnotation)
+	if !ok {
+		return true, "manifest has no input hash", nil
+	}
+	for _, app := range manifest.Apps {
+		if !imageInStore(opts.Runner, app.Image.ID) {
+			return true, fmt.Sprintf("image %v of app %v is missing in the store", app.Image.ID, app.Name), nil
+		}
+	}
+	if composeFile.secretFilesMissing(opts.SecretsDir) {
+		return true, "secret files are missing", nil
+	}
+	if name := composeFile.commandSecret(); name != "" {
+		return true, fmt.Sprintf("secret %v is printed by a command", name), nil
+	}
+	secrets, err := composeFile.resolveSecrets(opts.Runner)
+	if err != nil {
+		// prepare reports the error
+		return true, err.Error(), nil
+	}
+	imageIDs, missing := composeFile.storeImageIDs(opts)
+	if missing != nil {
+		return true, fmt.Sprintf("image %v of app %v is not in the store", missing.Image.imageURL(), missing.Name), nil
+	}
+	digest, err := composeFile.inputDigest()
+	if err != nil {
+		return false, "", err
+	}
+	if inputHash(digest, opts.LockFile, imageIDs, secrets) != hash {
+		return true, "inputs changed", nil
+	}
+	return false, "", nil
+}
+
+func setInputHash(manifest *schema.PodManifest, hash string) {
+	manifest.Annotations.Set(types.ACIdentifier(InputHashAnnotation), hash)
+}
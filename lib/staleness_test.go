@@ -0,0 +1,97 @@
+package lib
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/appc/spec/schema/types"
+)
+
+func TestPrepareNeeded(t *testing.T) {
+	path, cleanup := writeComposeFile(t, testComposeYAML)
+	defer cleanup()
+	manifestPath := filepath.Join(filepath.Dir(path), "manifest.json")
+	composeFile, err := NewComposeFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// tagged is the image docker://redis resolves to, store lists the
+	// images known to rkt
+	tagged, store := testImageID, map[string]bool{testImageID: true, otherImageID: true}
+	runner := newFakeRunner(func(cmd *Command) error {
+		switch cmd.Args[0] {
+		case "image":
+			if !store[cmd.Args[2]] {
+				return exitStatus(1)
+			}
+		case "fetch":
+			if !store[tagged] {
+				return exitStatus(1)
+			}
+			fmt.Fprintln(cmd.Stdout, tagged)
+		}
+		return nil
+	})
+	prepare := func(opts PrepareOptions) {
+		composeFile, err := NewComposeFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		output := &bytes.Buffer{}
+		if err := composeFile.Prepare(output, opts); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(manifestPath, output.Bytes(), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expectNeeded := func(opts PrepareOptions, expected string) {
+		t.Helper()
+		needed, reason, err := composeFile.PrepareNeeded(manifestPath, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if needed != (expected != "") || reason != expected {
+			t.Errorf("expected needed=%v with reason %q, got %v with %q", expected != "", expected, needed, reason)
+		}
+	}
+
+	opts := PrepareOptions{Runner: runner}
+	expectNeeded(opts, "no manifest found")
+	prepare(opts)
+	expectNeeded(opts, "")
+
+	tagged = otherImageID
+	expectNeeded(opts, "inputs changed")
+	prepare(opts)
+	expectNeeded(opts, "")
+
+	delete(store, otherImageID)
+	expectNeeded(opts, "image "+otherImageID+" of app redis is missing in the store")
+	tagged, store[otherImageID] = "sha512-00000000000000000000000000000001", true
+	expectNeeded(opts, "image docker://redis of app redis is not in the store")
+
+	// locked images do not follow the tag, but changes of the lock do
+	tagged = testImageID
+	opts.LockFile = composeFile.LockFilePath()
+	prepare(opts)
+	expectNeeded(opts, "")
+	tagged = otherImageID
+	expectNeeded(opts, "")
+	lock, err := ReadLockFile(opts.LockFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, _ := types.NewHash(otherImageID)
+	lock.Images[0].ID = *id
+	lock.Write(opts.LockFile)
+	expectNeeded(opts, "inputs changed")
+
+	os.Remove(manifestPath)
+	expectNeeded(opts, "no manifest found")
+}
@@ -1,43 +1,132 @@
 package lib
 
 import (
-	"os"
-	"os/exec"
+	"fmt"
+	"strconv"
+	"strings"
 )
 
-func Start(name string, podManifest, networks string, verbose bool, extra []string) error {
-	args := createRunArgList(podManifest, networks, false, verbose, extra)
-	args = append([]string{"--unit=" + name, "rkt"}, args...)
-	cmd := exec.Command("systemd-run", args...)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	cmd.Stdin = os.Stdin
-	return cmd.Run()
+// Start runs the pod as transient systemd unit called name.
+// The unit requires and is ordered after the units of the pods in
+// dependsOn, so it is stopped together with them.
+func Start(runner Runner, name, podManifest, uuidFile string, networks []*Network, restart *RestartPolicy, dependsOn []string, verbose bool, extra []string) error {
+	if err := CheckDefaultRoutes(networks, NetworkConfigDir); err != nil {
+		return err
+	}
+	args := []string{"--unit=" + name}
+	for _, dep := range dependsOn {
+		args = append(args, "--property=After="+dep+".service", "--property=Requires="+dep+".service")
+	}
+	if restart != nil {
+		unitProps, serviceProps, err := restart.properties()
+		if err != nil {
+			return err
+		}
+		for _, prop := range append(unitProps, serviceProps...) {
+			args = append(args, "--property="+prop)
+		}
+	}
+	args = append(args, "rkt")
+	args = append(args, createRunArgList(podManifest, uuidFile, networks, false, verbose, extra)...)
+	return runAttached(runner, "systemd-run", args...)
 }
 
-func Stop(name string) error {
-	cmd := exec.Command("systemctl", "stop", name+".service")
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	cmd.Stdin = os.Stdin
-	cmd.Run()
-	cmd = exec.Command("systemctl", "reset-failed", name+".service")
-	cmd.Run()
-	return nil
+// Stop stops the unit of the pod, ErrPodNotRunning is returned if it
+// is not running
+func Stop(runner Runner, name string) error {
+	state, err := GetUnitState(runner, name)
+	if err != nil {
+		return err
+	}
+	// failed units stay loaded until they are reset
+	defer runOutput(runner, "systemctl", "reset-failed", name+".service")
+	if !state.Running() {
+		return newError(ErrPodNotRunning, "pod %v is not running", name)
+	}
+	return runAttached(runner, "systemctl", "stop", name+".service")
 }
 
-func Status(name string) error {
-	cmd := exec.Command("systemctl", "status", name+".service")
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	cmd.Stdin = os.Stdin
-	return cmd.Run()
+// Status prints the status of the unit of the pod, ErrPodNotRunning is
+// returned if it is not running
+func Status(runner Runner, name string) error {
+	cmd := attachedCommand("systemctl", "status", name+".service")
+	cmd.Query = true
+	statusErr := run(runner, cmd)
+	state, err := GetUnitState(runner, name)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("\nRestarts: %v\n", state.Restarts)
+	if state.ExitCode != "" {
+		fmt.Printf("Last exit: %v\n", state.ExitCode)
+	}
+	if !state.Running() {
+		return newError(ErrPodNotRunning, "pod %v is not running", name)
+	}
+	return statusErr
 }
 
-func Restart(name string) error {
-	cmd := exec.Command("systemctl", "restart", name+".service")
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	cmd.Stdin = os.Stdin
-	return cmd.Run()
+// UnitState is the state of the systemd unit running a pod
+type UnitState struct {
+	// LoadState is "not-found" if there is no such unit
+	LoadState   string `json:"loadState"`
+	ActiveState string `json:"activeState"`
+	SubState    string `json:"subState"`
+	// Restarts counts the automatic restarts of the unit
+	Restarts int `json:"restarts"`
+	// ExitCode describes how the main process exited the last time,
+	// e.g. "status=1" or "signal=KILL"
+	ExitCode string `json:"exitCode,omitempty"`
+}
+
+// GetUnitState queries systemd for the state of the unit of the pod
+func GetUnitState(runner Runner, name string) (*UnitState, error) {
+	output, err := runQuery(runner, "systemctl", "show", name+".service",
+		"--property=LoadState,ActiveState,SubState,NRestarts,ExecMainCode,ExecMainStatus")
+	if err != nil {
+		return nil, err
+	}
+	props := map[string]string{}
+	for _, line := range strings.Split(output, "\n") {
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) == 2 {
+			props[parts[0]] = parts[1]
+		}
+	}
+	state := &UnitState{
+		LoadState:   props["LoadState"],
+		ActiveState: props["ActiveState"],
+		SubState:    props["SubState"],
+	}
+	state.Restarts, _ = strconv.Atoi(props["NRestarts"])
+	// ExecMainCode holds the CLD_* code of the last exit
+	switch props["ExecMainCode"] {
+	case "1":
+		state.ExitCode = "status=" + props["ExecMainStatus"]
+	case "2", "3":
+		state.ExitCode = "signal=" + props["ExecMainStatus"]
+	}
+	return state, nil
+}
+
+// Running reports whether the unit is running or about to be (re)started
+func (state *UnitState) Running() bool {
+	switch state.ActiveState {
+	case "", "inactive", "failed":
+		return false
+	}
+	return true
+}
+
+// Restart restarts the unit of the pod. Units created by start vanish once
+// they are stopped, restarting them gives ErrPodNotRunning.
+func Restart(runner Runner, name string) error {
+	state, err := GetUnitState(runner, name)
+	if err != nil {
+		return err
+	}
+	if state.LoadState == "not-found" {
+		return newError(ErrPodNotRunning, "pod %v is not running", name)
+	}
+	return runAttached(runner, "systemctl", "restart", name+".service")
 }
@@ -0,0 +1,76 @@
+package lib
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestStartPassesRestartPolicy(t *testing.T) {
+	runner := newFakeRunner(nil)
+	restart := &RestartPolicy{Policy: "on-failure", MaxRetries: 3, Backoff: "1s"}
+	if err := Start(runner, "test", "/pod/manifest.json", "/pod/.pod-uuid", []*Network{{Name: "default"}}, restart, []string{"db"}, false, nil); err != nil {
+		t.Fatal(err)
+	}
+	calls := runner.Calls()
+	if len(calls) != 1 {
+		t.Fatalf("expected a single call, got %q", calls)
+	}
+	for _, expected := range []string{
+		"systemd-run --unit=test ",
+		"--property=Restart=on-failure",
+		"--property=StartLimitBurst=4",
+		"--property=After=db.service --property=Requires=db.service",
+		" rkt run --pod-manifest=/pod/manifest.json --net=default --uuid-file-save=/pod/.pod-uuid",
+	} {
+		if !strings.Contains(calls[0], expected) {
+			t.Errorf("expected %q in %q", expected, calls[0])
+		}
+	}
+}
+
+func TestGetUnitState(t *testing.T) {
+	runner := newFakeRunner(func(cmd *Command) error {
+		fmt.Fprint(cmd.Stdout, "ActiveState=activating\nSubState=auto-restart\nNRestarts=4\nExecMainCode=2\nExecMainStatus=9\n")
+		return nil
+	})
+	state, err := GetUnitState(runner, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := UnitState{ActiveState: "activating", SubState: "auto-restart", Restarts: 4, ExitCode: "signal=9"}
+	if *state != expected {
+		t.Errorf("expected %+v, got %+v", expected, *state)
+	}
+	if calls := runner.Calls(); !strings.HasPrefix(calls[0], "systemctl show test.service ") {
+		t.Errorf("unexpected call %q", calls[0])
+	}
+}
+
+func TestStopNotRunning(t *testing.T) {
+	runner := newFakeRunner(func(cmd *Command) error {
+		if cmd.Args[0] == "show" {
+			fmt.Fprint(cmd.Stdout, "LoadState=not-found\nActiveState=inactive\n")
+		}
+		return nil
+	})
+	if err := Stop(runner, "test"); !errors.Is(err, ErrPodNotRunning) {
+		t.Errorf("expected ErrPodNotRunning, got %v", err)
+	}
+	for _, call := range runner.Calls() {
+		if strings.HasPrefix(call, "systemctl stop") {
+			t.Errorf("expected no stop call, got %q", call)
+		}
+	}
+}
+
+func TestGetUnitStateFailure(t *testing.T) {
+	runner := newFakeRunner(func(cmd *Command) error {
+		fmt.Fprintln(cmd.Stderr, "Failed to connect to bus")
+		return exitStatus(1)
+	})
+	if _, err := GetUnitState(runner, "test"); err == nil || !strings.Contains(err.Error(), "Failed to connect to bus") {
+		t.Errorf("expected the error of systemctl, got %v", err)
+	}
+}
@@ -0,0 +1,186 @@
+package lib
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// DefaultUnitDirectory is the directory unit files are installed to by default
+const DefaultUnitDirectory = "/etc/systemd/system"
+
+// A Unit describes a persistent systemd service running a pod
+type Unit struct {
+	Name        string
+	Description string
+	// PrepareCmd is run before the pod starts to bring the manifest up to date
+	PrepareCmd []string
+	// Environment is passed to the commands of the unit, systemd does not
+	// inherit the environment of the shell the unit was installed from
+	Environment map[string]string
+	// RunArgs are the arguments passed to rkt
+	RunArgs []string
+	// Wants lists the units pulled in along with the pod
+	Wants []string
+	// After lists the units the pod is ordered after, it does not pull
+	// them in
+	After    []string
+	WantedBy string
+	Restart  *RestartPolicy
+}
+
+// NewUnit creates a unit which runs the given pod manifest
+func NewUnit(name, podManifest, uuidFile string, networks []*Network, verbose bool, extra []string) *Unit {
+	return &Unit{
+		Name:        name,
+		Description: fmt.Sprintf("rkt-compose pod %v", name),
+		RunArgs:     createRunArgList(podManifest, uuidFile, networks, false, verbose, extra),
+		Wants:       []string{"network-online.target"},
+		After:       []string{"network-online.target"},
+		WantedBy:    "multi-user.target",
+		Restart:     &RestartPolicy{Policy: "on-failure"},
+	}
+}
+
+// String renders the unit file
+func (unit *Unit) String() (string, error) {
+	rkt := lookPath("rkt")
+	unitProps, serviceProps := []string{}, []string{}
+	if unit.Restart != nil {
+		var err error
+		if unitProps, serviceProps, err = unit.Restart.properties(); err != nil {
+			return "", err
+		}
+	}
+	lines := []string{
+		"# generated by rkt-compose",
+		"[Unit]",
+		"Description=" + unit.Description,
+	}
+	if len(unit.Wants) > 0 {
+		lines = append(lines, "Wants="+strings.Join(unit.Wants, " "))
+	}
+	if len(unit.After) > 0 {
+		lines = append(lines, "After="+strings.Join(unit.After, " "))
+	}
+	lines = append(lines, unitProps...)
+	lines = append(lines, "", "[Service]")
+	names := make([]string, 0, len(unit.Environment))
+	for name := range unit.Environment {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		lines = append(lines, "Environment="+unitEnvironment(name, unit.Environment[name]))
+	}
+	if len(unit.PrepareCmd) > 0 {
+		lines = append(lines, "ExecStartPre="+unitCommandLine(unit.PrepareCmd))
+	}
+	lines = append(lines,
+		"ExecStart="+unitCommandLine(append([]string{rkt}, unit.RunArgs...)),
+		"ExecStopPost="+unitCommandLine([]string{rkt, "gc", "--mark-only"}),
+		"KillMode=mixed",
+	)
+	lines = append(lines, serviceProps...)
+	if unit.WantedBy != "" {
+		lines = append(lines, "", "[Install]", "WantedBy="+unit.WantedBy)
+	}
+	return strings.Join(lines, "\n") + "\n", nil
+}
+
+// Install writes the unit file to dir and reloads systemd
+func (unit *Unit) Install(runner Runner, dir string) (string, error) {
+	content, err := unit.String()
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, unit.Name+".service")
+	if dryRun(runner) {
+		log.Printf("dry-run: would write %v:\n%v", path, content)
+		return path, systemctl(runner, "daemon-reload")
+	}
+	mode := os.FileMode(0644)
+	if len(unit.Environment) > 0 {
+		// the environment may contain credentials
+		mode = 0600
+	}
+	if err := WriteFileAtomic(path, []byte(content), mode); err != nil {
+		return "", err
+	}
+	log.Printf("installed %v", path)
+	return path, systemctl(runner, "daemon-reload")
+}
+
+// Enable enables the unit of the pod, so it starts on boot
+func Enable(runner Runner, name string) error {
+	return systemctl(runner, "enable", name+".service")
+}
+
+// Disable disables the unit of the pod
+func Disable(runner Runner, name string) error {
+	return systemctl(runner, "disable", name+".service")
+}
+
+// Uninstall stops and disables the unit of the pod and removes its file from dir
+func Uninstall(runner Runner, dir, name string) error {
+	path := filepath.Join(dir, name+".service")
+	if _, err := os.Stat(path); err != nil {
+		return err
+	}
+	if err := systemctl(runner, "disable", "--now", name+".service"); err != nil {
+		return err
+	}
+	if dryRun(runner) {
+		log.Printf("dry-run: would remove %v", path)
+		return systemctl(runner, "daemon-reload")
+	}
+	if err := os.Remove(path); err != nil {
+		return err
+	}
+	log.Printf("removed %v", path)
+	return systemctl(runner, "daemon-reload")
+}
+
+func systemctl(runner Runner, args ...string) error {
+	return run(runner, &Command{
+		Name:   "systemctl",
+		Args:   args,
+		Stdout: os.Stdout,
+		Stderr: os.Stderr,
+	})
+}
+
+// lookPath returns the absolute path of a binary, as systemd requires one
+func lookPath(name string) string {
+	if path, err := exec.LookPath(name); err == nil {
+		if abs, err := filepath.Abs(path); err == nil {
+			return abs
+		}
+	}
+	return "/usr/bin/" + name
+}
+
+// unitEnvironment quotes an assignment as expected by systemd in
+// Environment lines
+func unitEnvironment(name, value string) string {
+	assignment := strings.Replace(name+"="+value, "%", "%%", -1)
+	return `"` + strings.Replace(strings.Replace(assignment, `\`, `\\`, -1), `"`, `\"`, -1) + `"`
+}
+
+// unitCommandLine quotes args as expected by systemd in Exec lines
+func unitCommandLine(args []string) string {
+	quoted := make([]string, len(args))
+	for idx, arg := range args {
+		arg = strings.Replace(arg, "%", "%%", -1)
+		arg = strings.Replace(arg, "$", "$$", -1)
+		if arg == "" || strings.ContainsAny(arg, " \t\"'\\;") {
+			arg = `"` + strings.Replace(strings.Replace(arg, `\`, `\\`, -1), `"`, `\"`, -1) + `"`
+		}
+		quoted[idx] = arg
+	}
+	return strings.Join(quoted, " ")
+}
@@ -0,0 +1,85 @@
+package lib
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestUnitString(t *testing.T) {
+	unit := NewUnit("web", "/srv/web/pod-manifest.json", "/srv/web/pod.uuid", nil, false, nil)
+	unit.PrepareCmd = []string{"/usr/bin/rkt-compose", "--file", "/srv/web/rkt-compose.yaml", "prepare"}
+	unit.Environment = map[string]string{"VERSION": "1.2", "PASSWORD": `50% "off"`}
+	unit.Restart = &RestartPolicy{Policy: "always", MaxRetries: 3, Backoff: "2s"}
+	content, err := unit.String()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rkt := lookPath("rkt")
+	expected := `# generated by rkt-compose
+[Unit]
+Description=rkt-compose pod web
+Wants=network-online.target
+After=network-online.target
+StartLimitIntervalSec=infinity
+StartLimitBurst=4
+
+[Service]
+Environment="PASSWORD=50%% \"off\""
+Environment="VERSION=1.2"
+ExecStartPre=/usr/bin/rkt-compose --file /srv/web/rkt-compose.yaml prepare
+ExecStart=` + unitCommandLine(append([]string{rkt}, unit.RunArgs...)) + `
+ExecStopPost=` + rkt + ` gc --mark-only
+KillMode=mixed
+Restart=always
+RestartSec=2000ms
+
+[Install]
+WantedBy=multi-user.target
+`
+	if content != expected {
+		t.Errorf("expected\n%v\ngot\n%v", expected, content)
+	}
+
+	// ordering a unit after another one does not pull it in
+	unit.Wants = nil
+	unit.After = []string{"network-online.target", "db.service"}
+	if content, _ = unit.String(); !strings.Contains(content, "Description=rkt-compose pod web\nAfter=network-online.target db.service\n") {
+		t.Errorf("expected only After= to be set, got\n%v", content)
+	}
+
+	unit.Restart = &RestartPolicy{Policy: "sometimes"}
+	if _, err := unit.String(); err == nil {
+		t.Error("expected an invalid restart policy to fail")
+	}
+}
+
+func TestUnitInstallMode(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rkt-compose-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "web.service")
+	if err := ioutil.WriteFile(path, []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	unit := NewUnit("web", "/srv/web/pod-manifest.json", "/srv/web/pod.uuid", nil, false, nil)
+	unit.Environment = map[string]string{"PASSWORD": "secret"}
+	runner := newFakeRunner(nil)
+	if _, err := unit.Install(runner, dir); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("expected a unit with environment to be only readable by root, got %v", info.Mode())
+	}
+	if calls := runner.Calls(); len(calls) != 1 || calls[0] != "systemctl daemon-reload" {
+		t.Errorf("expected systemd to be reloaded, got %q", calls)
+	}
+}
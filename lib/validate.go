@@ -0,0 +1,490 @@
+package lib
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/appc/spec/schema/types"
+	"github.com/appc/spec/schema/types/resource"
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// A ValidationError describes a single problem found in a compose file
+type ValidationError struct {
+	File    string
+	Line    int
+	Path    string
+	Message string
+}
+
+func (err *ValidationError) Error() string {
+	location := err.File
+	if err.Line > 0 {
+		location = fmt.Sprintf("%v:%v", location, err.Line)
+	}
+	msg := err.Message
+	if err.Path != "" {
+		msg = err.Path + ": " + msg
+	}
+	if location == "" {
+		return msg
+	}
+	return location + ": " + msg
+}
+
+// ValidationErrors collects all problems found in a compose file
+type ValidationErrors []*ValidationError
+
+func (errs ValidationErrors) Error() string {
+	msgs := make([]string, len(errs))
+	for idx, err := range errs {
+		msgs[idx] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// Is makes validation errors match ErrInvalidComposeFile
+func (errs ValidationErrors) Is(kind error) bool {
+	return kind == ErrInvalidComposeFile
+}
+
+// composeSource keeps the parsed yaml tree of a single compose file,
+// so that problems can be reported with line numbers
+type composeSource struct {
+	path      string
+	doc       *yamlv3.Node
+	variables map[string]*string
+	warnings  ValidationErrors
+}
+
+// Warnings returns problems which do not prevent the compose file from
+// being used, like secrets given as literal values, fields ignored by
+// stage1-fly or extra flags conflicting with fields
+func (composeFile *ComposeFile) Warnings() ValidationErrors {
+	warnings := ValidationErrors{}
+	for _, source := range composeFile.sources {
+		warnings = append(warnings, source.warnings...)
+	}
+	warnings = append(warnings, composeFile.flyWarnings()...)
+	return append(warnings, composeFile.hostConflicts()...)
+}
+
+// warning creates a warning about the value at path
+func (composeFile *ComposeFile) warning(path, format string, args ...interface{}) *ValidationError {
+	file, line := composeFile.locate(path)
+	return &ValidationError{
+		File:    file,
+		Line:    line,
+		Path:    path,
+		Message: fmt.Sprintf(format, args...),
+	}
+}
+
+// Validate checks the compose file for problems and reports all of them.
+// The returned error is nil or of type ValidationErrors.
+func (composeFile *ComposeFile) Validate() error {
+	errs := ValidationErrors{}
+	report := func(path, format string, args ...interface{}) {
+		file, line := composeFile.locate(path)
+		errs = append(errs, &ValidationError{
+			File:    file,
+			Line:    line,
+			Path:    path,
+			Message: fmt.Sprintf(format, args...),
+		})
+	}
+	for _, source := range composeFile.sources {
+		errs = append(errs, source.checkDuplicates()...)
+	}
+
+	volumes := map[types.ACName]bool{}
+	for _, vol := range composeFile.Manifest.Volumes {
+		path := fmt.Sprintf("manifest.volumes[%v]", vol.Name)
+		if _, err := types.NewACName(string(vol.Name)); err != nil {
+			report(path+".name", "invalid volume name %q: %v", vol.Name, err)
+		}
+		switch vol.Kind {
+		case "", "host", "empty":
+		default:
+			report(path+".kind", "unknown volume kind %q (must be host or empty)", vol.Kind)
+		}
+		volumes[vol.Name] = true
+	}
+	for _, app := range composeFile.Manifest.Apps {
+		path := fmt.Sprintf("manifest.apps[%v]", app.Name)
+		if _, err := types.NewACName(string(app.Name)); err != nil {
+			report(path+".name", "invalid app name %q: %v", app.Name, err)
+		}
+		if app.Image.Name == "" && app.Image.ID.Empty() {
+			report(path+".image", "either image name or id must be specified")
+		}
+		for _, mount := range app.Mounts {
+			if !volumes[mount.Volume] && mount.AppVolume == nil {
+				report(path+".mounts", "mount of volume %q has no matching volume", mount.Volume)
+			}
+		}
+		if app.Healthcheck != nil {
+			if err := app.Healthcheck.check(); err != nil {
+				report(path+".healthcheck", "%v", err)
+			}
+		}
+		if app.App == nil {
+			continue
+		}
+		if app.App.CPU != "" || app.App.CPURequest != "" {
+			if _, _, err := resourceRange("cpu", app.App.CPURequest, app.App.CPU); err != nil {
+				report(path+".app.cpu", "%v", err)
+			}
+		}
+		if app.App.Memory != "" || app.App.MemoryRequest != "" {
+			if _, _, err := resourceRange("memory", app.App.MemoryRequest, app.App.Memory); err != nil {
+				report(path+".app.memory", "%v", err)
+			}
+		}
+		for _, mountPoint := range app.App.MountPoints {
+			if _, err := types.NewACName(string(mountPoint.Name)); err != nil {
+				report(path+".app.mountPoints", "invalid mount point name %q: %v", mountPoint.Name, err)
+			}
+			if !volumes[mountPoint.Name] {
+				report(path+".app.mountPoints", "mount point %q has no matching volume", mountPoint.Name)
+			}
+		}
+	}
+	composeFile.Manifest.checkOrdering(report)
+	composeFile.Manifest.checkPorts(report)
+	composeFile.checkSecrets(report)
+	composeFile.checkNetworks(report)
+	composeFile.checkHost(report)
+	composeFile.checkStage1(report)
+	if composeFile.CPU != "" {
+		if _, err := resource.ParseQuantity(composeFile.CPU); err != nil {
+			report("cpu", "invalid cpu quantity %q: %v", composeFile.CPU, err)
+		}
+	}
+	if composeFile.Memory != "" {
+		if _, err := resource.ParseQuantity(composeFile.Memory); err != nil {
+			report("memory", "invalid memory quantity %q: %v", composeFile.Memory, err)
+		}
+	}
+	if composeFile.Restart != nil {
+		if err := composeFile.Restart.check(); err != nil {
+			report("restart", "%v", err)
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// locate finds the file and line defining the value at path.
+// List entries can be addressed by index or by name (apps[etcd]).
+// The last file defining the value wins, as it is the one that took effect.
+func (composeFile *ComposeFile) locate(path string) (string, int) {
+	for idx := len(composeFile.sources) - 1; idx >= 0; idx-- {
+		source := composeFile.sources[idx]
+		if node := lookupNode(source.doc, path); node != nil {
+			return source.path, node.Line
+		}
+	}
+	for idx := len(composeFile.sources) - 1; idx >= 0; idx-- {
+		// fall back to the closest parent that exists
+		source := composeFile.sources[idx]
+		for parent := path; parent != ""; {
+			cut := strings.LastIndexAny(parent, ".[")
+			if cut < 0 {
+				break
+			}
+			parent = parent[:cut]
+			if node := lookupNode(source.doc, parent); node != nil {
+				return source.path, node.Line
+			}
+		}
+	}
+	return "", 0
+}
+
+// locateEntry returns the file, line and index of the n-th entry with the
+// given value in the lists at path. It is used for lists which are appended
+// on merge, the merged index does not tell the file of an entry.
+func (composeFile *ComposeFile) locateEntry(path, value string, n int) (string, int, int) {
+	for _, source := range composeFile.sources {
+		node := lookupNode(source.doc, path)
+		if node == nil || node.Kind != yamlv3.SequenceNode {
+			continue
+		}
+		for idx, entry := range node.Content {
+			if entry.Kind != yamlv3.ScalarNode || entry.Value != value {
+				continue
+			}
+			if n == 0 {
+				return source.path, entry.Line, idx
+			}
+			n--
+		}
+	}
+	return "", 0, -1
+}
+
+// lookupNode resolves a field path like manifest.apps[etcd].app.exec
+func lookupNode(node *yamlv3.Node, path string) *yamlv3.Node {
+	if node != nil && node.Kind == yamlv3.DocumentNode && len(node.Content) > 0 {
+		node = node.Content[0]
+	}
+	for path != "" && node != nil {
+		var key string
+		if path[0] == '[' {
+			end := strings.Index(path, "]")
+			if end < 0 {
+				return nil
+			}
+			key, path = path[1:end], path[end+1:]
+			node = sequenceEntry(node, key)
+		} else {
+			end := strings.IndexAny(path, ".[")
+			if end < 0 {
+				end = len(path)
+			}
+			key, path = path[:end], path[end:]
+			node = mappingValue(node, key)
+		}
+		path = strings.TrimPrefix(path, ".")
+	}
+	return node
+}
+
+func mappingValue(node *yamlv3.Node, key string) *yamlv3.Node {
+	if node == nil || node.Kind != yamlv3.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// sequenceEntry returns the entry at index key or the mapping with a
+// matching name field
+func sequenceEntry(node *yamlv3.Node, key string) *yamlv3.Node {
+	if node == nil || node.Kind != yamlv3.SequenceNode {
+		return nil
+	}
+	var idx int
+	if _, err := fmt.Sscanf(key, "%d", &idx); err == nil && fmt.Sprint(idx) == key {
+		if idx >= 0 && idx < len(node.Content) {
+			return node.Content[idx]
+		}
+		return nil
+	}
+	for _, entry := range node.Content {
+		if name := entryName(entry); name != nil && name.Value == key {
+			return entry
+		}
+	}
+	return nil
+}
+
+// entryName returns the name field of a list entry, entries like networks
+// may also be given as plain name
+func entryName(entry *yamlv3.Node) *yamlv3.Node {
+	if entry.Kind == yamlv3.ScalarNode {
+		return entry
+	}
+	return mappingValue(entry, "name")
+}
+
+func (source *composeSource) checkDuplicates() ValidationErrors {
+	errs := ValidationErrors{}
+	for _, list := range []string{"manifest.apps", "manifest.volumes", "secrets", "networks"} {
+		node := lookupNode(source.doc, list)
+		if node == nil || node.Kind != yamlv3.SequenceNode {
+			continue
+		}
+		seen := map[string]bool{}
+		for idx, entry := range node.Content {
+			name := entryName(entry)
+			if name == nil {
+				continue
+			}
+			if seen[name.Value] {
+				errs = append(errs, &ValidationError{
+					File:    source.path,
+					Line:    name.Line,
+					Path:    fmt.Sprintf("%v[%v].name", list, idx),
+					Message: fmt.Sprintf("duplicate name %q", name.Value),
+				})
+			}
+			seen[name.Value] = true
+		}
+	}
+	return errs
+}
+
+var (
+	jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	rawMessageType      = reflect.TypeOf(json.RawMessage{})
+)
+
+// hasCustomDecoding reports if values of type t are not decoded field by field
+func hasCustomDecoding(t reflect.Type) bool {
+	ptr := reflect.PtrTo(t)
+	return ptr.Implements(jsonUnmarshalerType) || ptr.Implements(textUnmarshalerType)
+}
+
+// checkSchema walks the yaml tree along the go type t and reports unknown
+// keys and values that can not be decoded into their target type
+func checkSchema(node *yamlv3.Node, t reflect.Type, path string) ValidationErrors {
+	errs := ValidationErrors{}
+	report := func(node *yamlv3.Node, path, format string, args ...interface{}) {
+		errs = append(errs, &ValidationError{
+			Line:    node.Line,
+			Path:    path,
+			Message: fmt.Sprintf(format, args...),
+		})
+	}
+	var walk func(node *yamlv3.Node, t reflect.Type, path string)
+	walk = func(node *yamlv3.Node, t reflect.Type, path string) {
+		if node.Kind == yamlv3.DocumentNode {
+			for _, child := range node.Content {
+				walk(child, t, path)
+			}
+			return
+		}
+		if node.Kind == yamlv3.AliasNode {
+			node = node.Alias
+		}
+		if node.Kind == yamlv3.ScalarNode && node.ShortTag() == "!!null" {
+			return
+		}
+		for t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		if t == rawMessageType || t.Kind() == reflect.Interface {
+			return
+		}
+		if hasCustomDecoding(t) {
+			// types with custom decoding get checked as a whole, but only if
+			// the structural checks below did not already find a problem
+			numErrs := len(errs)
+			defer func() {
+				if len(errs) > numErrs {
+					return
+				}
+				if err := decodeNode(node, reflect.New(t).Interface()); err != nil {
+					report(node, path, "%v", err)
+				}
+			}()
+		}
+		switch t.Kind() {
+		case reflect.Struct:
+			if node.Kind != yamlv3.MappingNode {
+				if !hasCustomDecoding(t) {
+					report(node, path, "expected a mapping")
+				}
+				return
+			}
+			fields := jsonFields(t)
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				key, value := node.Content[i], node.Content[i+1]
+				field, ok := fields[key.Value]
+				if !ok {
+					msg := fmt.Sprintf("unknown field %q", key.Value)
+					if suggestion := suggestField(fields, key.Value); suggestion != "" {
+						msg += fmt.Sprintf(", did you mean %q?", suggestion)
+					}
+					report(key, joinFieldPath(path, key.Value), "%v", msg)
+					continue
+				}
+				walk(value, field.Type, joinFieldPath(path, key.Value))
+			}
+		case reflect.Slice:
+			if node.Kind != yamlv3.SequenceNode {
+				if !hasCustomDecoding(t) {
+					report(node, path, "expected a list")
+				}
+				return
+			}
+			for idx, child := range node.Content {
+				walk(child, t.Elem(), fmt.Sprintf("%v[%v]", path, idx))
+			}
+		case reflect.Map:
+			if node.Kind != yamlv3.MappingNode {
+				report(node, path, "expected a mapping")
+				return
+			}
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				walk(node.Content[i+1], t.Elem(), joinFieldPath(path, node.Content[i].Value))
+			}
+		case reflect.Bool:
+			if node.Kind != yamlv3.ScalarNode || node.ShortTag() != "!!bool" {
+				report(node, path, "expected a boolean")
+			}
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			if node.Kind != yamlv3.ScalarNode || node.ShortTag() != "!!int" {
+				report(node, path, "expected an integer")
+			}
+		case reflect.String:
+			if node.Kind != yamlv3.ScalarNode {
+				report(node, path, "expected a string")
+			}
+		}
+	}
+	walk(node, t, path)
+	return errs
+}
+
+// jsonFields returns the fields of struct type t by their json name
+func jsonFields(t reflect.Type) map[string]reflect.StructField {
+	fields := map[string]reflect.StructField{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		fields[name] = field
+	}
+	return fields
+}
+
+func suggestField(fields map[string]reflect.StructField, key string) string {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if strings.EqualFold(name, key) {
+			return name
+		}
+	}
+	return ""
+}
+
+// decodeNode decodes node into target using the json representation,
+// just like the compose file itself gets decoded
+func decodeNode(node *yamlv3.Node, target interface{}) error {
+	var value interface{}
+	if err := node.Decode(&value); err != nil {
+		return err
+	}
+	bs, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(bs, target)
+}
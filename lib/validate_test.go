@@ -0,0 +1,114 @@
+package lib
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNewComposeFileValidation(t *testing.T) {
+	tests := []struct {
+		name     string
+		yaml     string
+		expected []string
+	}{
+		{
+			name: "invalid app name",
+			yaml: `
+manifest:
+  apps:
+    - name: Web_App
+      image: {name: docker://nginx}`,
+			expected: []string{`rkt-compose.yaml:4: manifest.apps[0].name: ACName must contain only lower case`},
+		},
+		{
+			name: "invalid volume name",
+			yaml: `
+manifest:
+  apps:
+    - name: web
+      image: {name: docker://nginx}
+  volumes:
+    - {name: my_data, kind: empty}`,
+			expected: []string{`rkt-compose.yaml:7: manifest.volumes[0].name: ACName must contain only lower case`},
+		},
+		{
+			name: "duplicate app names",
+			yaml: `
+manifest:
+  apps:
+    - name: web
+      image: {name: docker://nginx}
+    - name: web
+      image: {name: docker://httpd}`,
+			expected: []string{`rkt-compose.yaml:6: manifest.apps[1].name: duplicate name "web"`},
+		},
+		{
+			name: "mount point without volume",
+			yaml: `
+manifest:
+  apps:
+    - name: web
+      image: {name: docker://nginx}
+      app:
+        mountPoints: [{name: data, path: /data}]`,
+			expected: []string{`rkt-compose.yaml:7: manifest.apps[web].app.mountPoints: mount point "data" has no matching volume`},
+		},
+		{
+			name: "bad quantities",
+			yaml: `
+cpu: lots
+manifest:
+  apps:
+    - name: web
+      image: {name: docker://nginx}
+      app:
+        memory: 12 parsecs`,
+			expected: []string{
+				`rkt-compose.yaml:8: manifest.apps[web].app.memory: invalid memory request "12 parsecs"`,
+				`rkt-compose.yaml:2: cpu: invalid cpu quantity "lots"`,
+			},
+		},
+		{
+			name: "schema and validation errors are reported together",
+			yaml: `
+Memory: 1G
+cpu: lots
+manifest:
+  apps:
+    - name: web
+      image: {name: docker://nginx}
+      app:
+        mountPoints: [{name: data, path: /data}]`,
+			expected: []string{
+				`rkt-compose.yaml:2: Memory: unknown field "Memory", did you mean "memory"?`,
+				`rkt-compose.yaml:9: manifest.apps[web].app.mountPoints: mount point "data" has no matching volume`,
+				`rkt-compose.yaml:3: cpu: invalid cpu quantity "lots"`,
+			},
+		},
+	}
+	for _, test := range tests {
+		path, cleanup := writeComposeFile(t, test.yaml)
+		_, err := NewComposeFile(path)
+		cleanup()
+		errs, ok := err.(ValidationErrors)
+		if !ok {
+			t.Errorf("%v: expected validation errors, got %v", test.name, err)
+			continue
+		}
+		if !errors.Is(err, ErrInvalidComposeFile) {
+			t.Errorf("%v: expected the errors to match ErrInvalidComposeFile", test.name)
+		}
+		if len(errs) != len(test.expected) {
+			t.Errorf("%v: expected %v errors, got:\n%v", test.name, len(test.expected), err)
+			continue
+		}
+		for idx, expected := range test.expected {
+			msg := strings.TrimPrefix(errs[idx].Error(), filepath.Dir(path)+string(filepath.Separator))
+			if !strings.HasPrefix(msg, expected) {
+				t.Errorf("%v: expected %q, got %q", test.name, expected, msg)
+			}
+		}
+	}
+}